@@ -0,0 +1,163 @@
+package filecollate
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Length of the hex encoded crc32 hash of a single chunk.
+const chunkHashLen = crc32.Size * 2
+
+// EXPERIMENTAL: the key format and clustering may change.
+//
+// ChunkHashKeyGenerator returns a KeyGeneratorFunc whose key is the chunk map of the file, that is
+// the hex encoded crc32 hashes of every fixed-size chunk of the file contents concatenated in order.
+// Files with the same key are fully identical, while ClusterByChunks groups files that only share a
+// fraction of their chunks.
+//
+// The entire file is read, and the key grows by 8 bytes per chunk (e.g. ~8KB for a 1GB file with
+// 1MB chunks), so pick a chunk size that keeps the keys of all scanned files in memory.
+func ChunkHashKeyGenerator(chunkSize int64) KeyGeneratorFunc {
+	return func(path string) (string, error) {
+		if chunkSize <= 0 {
+			return "", fmt.Errorf("invalid chunk size: %d", chunkSize)
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+
+		defer file.Close()
+
+		var key strings.Builder
+		r := bufio.NewReader(file)
+		hash := crc32.NewIEEE()
+
+		for {
+			hash.Reset()
+			n, err := io.CopyN(hash, r, chunkSize)
+			if n > 0 {
+				key.WriteString(hex.EncodeToString(hash.Sum(nil)))
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+		}
+
+		return key.String(), nil
+	}
+}
+
+// Returned without searching by ClusterByChunks if the Cfg sets an option which alters or replaces
+// the chunk map keys (KeyPrefix, TagFunc, FastUnsafe or SelectKeyGenerator).
+var ErrChunkKeysAltered = errors.New("options alter the chunk map keys")
+
+// EXPERIMENTAL: the clustering may change.
+//
+// ClusterByChunks runs the search with ChunkHashKeyGenerator and groups files sharing at least the
+// threshold fraction (0 < threshold <= 1) of their chunks, relative to the file with more chunks.
+// Useful to report block-level duplication of large files like VM images, that share most but not
+// all of their content. Similarity is transitive, so if A is similar to B and B to C, all three end
+// up in the same cluster.
+//
+// The search fails with ErrChunkKeysAltered if the Cfg alters the keys, since the chunks are
+// sliced from them. On top of reading every file entirely, each file is compared against all files that share at least
+// one of its chunks, so chunks common to most files (e.g. zeroed blocks) can make this quadratic.
+func ClusterByChunks(c Cfg, chunkSize int64, threshold float64) ([][]string, error) {
+	if c.KeyPrefix != "" || c.TagFunc != nil || c.FastUnsafe || c.SelectKeyGenerator != nil {
+		return nil, ErrChunkKeysAltered // The chunks are sliced from the keys at fixed offsets
+	}
+	c.KeyGenerator = ChunkHashKeyGenerator(chunkSize)
+
+	keys, err := collectKeys(c)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(keys))
+	for path := range keys {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	// Unique chunks of each file and the files (indices into paths) containing each chunk.
+	chunks := make([]map[string]struct{}, len(paths))
+	index := make(map[string][]int)
+
+	for i, path := range paths {
+		key := keys[path]
+		chunks[i] = make(map[string]struct{}, len(key)/chunkHashLen)
+
+		for j := 0; j+chunkHashLen <= len(key); j += chunkHashLen {
+			chunk := key[j : j+chunkHashLen]
+			if _, ok := chunks[i][chunk]; ok {
+				continue
+			}
+			chunks[i][chunk] = struct{}{}
+			index[chunk] = append(index[chunk], i)
+		}
+	}
+
+	// Union-find over the files to build the clusters.
+	parent := make([]int, len(paths))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range paths {
+		shared := make(map[int]int) // other file -> num of shared chunks
+		for chunk := range chunks[i] {
+			for _, j := range index[chunk] {
+				if j > i {
+					shared[j]++
+				}
+			}
+		}
+
+		for j, n := range shared {
+			total := max(len(chunks[i]), len(chunks[j]))
+			if float64(n)/float64(total) >= threshold {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	clusters := make(map[int][]string)
+	for i, path := range paths {
+		root := find(i)
+		clusters[root] = append(clusters[root], path)
+	}
+
+	var groups [][]string
+	for _, cluster := range clusters {
+		if len(cluster) > 1 {
+			groups = append(groups, cluster)
+		}
+	}
+
+	// Paths are sorted within clusters, so sort the clusters by their first path.
+	slices.SortFunc(groups, func(a, b []string) int {
+		return strings.Compare(a[0], b[0])
+	})
+
+	return groups, nil
+}
@@ -0,0 +1,80 @@
+package filecollate
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChunkHashKeyGenerator(t *testing.T) {
+	paths := writeFiles(t, t.TempDir(),
+		[2]string{"a", "aaaabbbbcc"},
+		[2]string{"b", "aaaaxxxxcc"},
+	)
+
+	keyA, err := ChunkHashKeyGenerator(4)(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyB, err := ChunkHashKeyGenerator(4)(paths[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 3 chunks, the last one being shorter
+	if len(keyA) != 3*chunkHashLen || len(keyB) != 3*chunkHashLen {
+		t.Fatalf("Expected keys with 3 chunks, got %s and %s", keyA, keyB)
+	}
+
+	if keyA[:chunkHashLen] != keyB[:chunkHashLen] || keyA[2*chunkHashLen:] != keyB[2*chunkHashLen:] {
+		t.Errorf("Expected first and last chunks to match, got %s and %s", keyA, keyB)
+	}
+
+	if keyA[chunkHashLen:2*chunkHashLen] == keyB[chunkHashLen:2*chunkHashLen] {
+		t.Errorf("Expected middle chunks to differ, got %s and %s", keyA, keyB)
+	}
+}
+
+func TestClusterByChunks(t *testing.T) {
+	root := t.TempDir()
+	paths := writeFiles(t, root,
+		[2]string{"image1", strings.Repeat("a", 4) + strings.Repeat("b", 4) + strings.Repeat("c", 4) + "dddd"},
+		[2]string{"image2", strings.Repeat("a", 4) + strings.Repeat("b", 4) + strings.Repeat("c", 4) + "eeee"},
+		[2]string{"other", "zzzzyyyyxxxxwwww"},
+	)
+
+	cfg := Cfg{Paths: []string{root}, Workers: 4}
+
+	groups, err := ClusterByChunks(cfg, 4, 0.75)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{{paths[0], paths[1]}}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("Expected %v, got %v", expected, groups)
+	}
+
+	groups, err = ClusterByChunks(cfg, 4, 0.8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 0 {
+		t.Errorf("Expected no clusters above the threshold, got %v", groups)
+	}
+
+	// Options that alter the keys would shift the chunks.
+	for _, c := range []Cfg{
+		{KeyPrefix: "v1:"},
+		{TagFunc: func(string) (string, error) { return "tag", nil }},
+		{FastUnsafe: true, AcknowledgeCollisionRisk: true},
+	} {
+		c.Paths = cfg.Paths
+		if _, err := ClusterByChunks(c, 4, 0.75); !errors.Is(err, ErrChunkKeysAltered) {
+			t.Errorf("Expected ErrChunkKeysAltered, got %v", err)
+		}
+	}
+}
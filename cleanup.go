@@ -0,0 +1,315 @@
+package filecollate
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Returned by PlanCleanup if a same-device constraint can't be checked, since the device of the
+// members is unknown (not Unix).
+var ErrNoDeviceInfo = errors.New("device info unavailable")
+
+// Strategy to pick the keeper of a group when planning a cleanup. Ties are broken by the lexically
+// smallest path, so the choice is always deterministic.
+type KeepStrategy int
+
+const (
+	KeepLexical    KeepStrategy = iota // Keeps the lexically smallest path, like Cfg.ExcludeKeeper.
+	KeepOldest                         // Keeps the member with the oldest modification time.
+	KeepNewest                         // Keeps the member with the newest modification time.
+	KeepShallowest                     // Keeps the member with the fewest path elements.
+)
+
+type CleanupOptions struct {
+	// Members below these dirs are never deleted, and one of them is preferred as the keeper.
+	ProtectedRoots []string
+
+	// How the keeper is picked among the (protected, if any) members of a group.
+	Keep KeepStrategy
+
+	// Only plans members on the same device as the keeper as deletable, since hardlinks can't span
+	// filesystems. Members already hardlinked to the keeper need no action and are left out.
+	SameDevice bool
+
+	// Called only for groups where the Keep strategy can't decide, i.e. multiple candidates tie on
+	// their modification time or depth, with the tied candidates to return the index of the keeper
+	// among them, e.g. to prompt the user for just the hard cases. Returning an error leaves the group
+	// out of the plan. Without it, ties are broken by the lexically smallest path.
+	ResolveKeeper func(group []FileGroupMember) (keepIndex int, err error)
+}
+
+// Planned cleanup of a single group.
+type CleanupAction struct {
+	Key       string
+	Keeper    FileGroupMember
+	Delete    []FileGroupMember // Members that are safe to delete (or replace with a link to the keeper).
+	Protected []FileGroupMember // Members kept besides the keeper since they're below a protected root.
+	Skipped   []FileGroupMember // Members kept since they're on another device than the keeper.
+	Links     []FileGroupMember // Symlinks kept since deleting them frees nothing, or deletes the real file.
+}
+
+// Plan of what a cleanup does to each group, e.g. to preview it before anything is touched.
+type CleanupPlan struct {
+	Actions          []CleanupAction // In the order of the planned groups.
+	ReclaimableBytes int64           // Bytes freed by deleting all deletable members.
+	Unresolved       []string        // Keys of the groups left out since ResolveKeeper failed.
+}
+
+// PlanCleanup determines the keeper and the deletable members of each of the provided groups
+// while respecting the protected roots and the same-device constraint of the provided options.
+// Nothing is touched, the returned plan only describes what should happen.
+func PlanCleanup(groups []FileGroup, opts CleanupOptions) (CleanupPlan, error) {
+	if opts.Keep < KeepLexical || opts.Keep > KeepShallowest {
+		return CleanupPlan{}, fmt.Errorf("invalid keep strategy: %d", opts.Keep)
+	}
+
+	protected := cleanPaths(opts.ProtectedRoots)
+
+	var plan CleanupPlan
+	for _, g := range groups {
+		if len(g.AllMembers()) < 2 {
+			continue // Nothing to clean up
+		}
+
+		action, ok, err := planGroup(g, protected, opts)
+		if err != nil {
+			return CleanupPlan{}, err
+		}
+		if !ok {
+			plan.Unresolved = append(plan.Unresolved, g.Key)
+			continue
+		}
+
+		plan.Actions = append(plan.Actions, action)
+		plan.ReclaimableBytes += reclaimableBytes(action, g.GroupSize)
+	}
+
+	return plan, nil
+}
+
+// Returns the planned action of the provided group, or false if ResolveKeeper failed.
+func planGroup(g FileGroup, protected []string, opts CleanupOptions) (CleanupAction, bool, error) {
+	members := g.AllMembers()
+
+	var files, candidates []FileGroupMember // Members the keeper is picked from
+	for _, m := range members {
+		if m.Type == MemberSymlink {
+			continue
+		}
+		files = append(files, m)
+		if isProtected(m.Path, protected) {
+			candidates = append(candidates, m)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = files
+	}
+	if len(candidates) == 0 {
+		return CleanupAction{Key: g.Key, Links: members}, true, nil // Nothing but symlinks to keep
+	}
+
+	keeper, ok, err := pickKeeper(candidates, opts)
+	if err != nil || !ok {
+		return CleanupAction{}, false, err
+	}
+
+	action := CleanupAction{Key: g.Key, Keeper: keeper}
+	for _, m := range members {
+		switch {
+		case m.Path == keeper.Path:
+		case m.Type == MemberSymlink:
+			action.Links = append(action.Links, m)
+		case isProtected(m.Path, protected):
+			action.Protected = append(action.Protected, m)
+		case opts.SameDevice && (m.Dev == 0 || keeper.Dev == 0):
+			return CleanupAction{}, false, fmt.Errorf("%w: %s", ErrNoDeviceInfo, m.Path)
+		case opts.SameDevice && m.Dev != keeper.Dev:
+			action.Skipped = append(action.Skipped, m)
+		case opts.SameDevice && m.Ino == keeper.Ino:
+			// Already a hardlink of the keeper
+		default:
+			action.Delete = append(action.Delete, m)
+		}
+	}
+
+	return action, true, nil
+}
+
+// Picks the keeper among the provided candidates with the Keep strategy, asking the ResolveKeeper
+// if the strategy ties. Returns false if ResolveKeeper failed.
+func pickKeeper(candidates []FileGroupMember, opts CleanupOptions) (FileGroupMember, bool, error) {
+	keeper := bestKeeper(candidates, opts.Keep)
+
+	if opts.ResolveKeeper == nil {
+		return keeper, true, nil
+	}
+
+	var tied []FileGroupMember
+	for _, m := range candidates {
+		if ties(m, keeper, opts.Keep) {
+			tied = append(tied, m)
+		}
+	}
+	if len(tied) < 2 {
+		return keeper, true, nil
+	}
+
+	i, err := opts.ResolveKeeper(tied)
+	if err != nil {
+		return FileGroupMember{}, false, nil
+	}
+	if i < 0 || i >= len(tied) {
+		return FileGroupMember{}, false, fmt.Errorf("keeper index %d out of range of %d tied members", i, len(tied))
+	}
+	return tied[i], true, nil
+}
+
+// Returns the best keeper among the provided members for the strategy.
+func bestKeeper(members []FileGroupMember, strategy KeepStrategy) FileGroupMember {
+	keeper := members[0]
+	for _, m := range members[1:] {
+		if keepsBefore(m, keeper, strategy) {
+			keeper = m
+		}
+	}
+	return keeper
+}
+
+// Returns the keeper of the provided group for the strategy, like PlanCleanup picks it without
+// protected roots. Symlinks are only kept if the group has no other members.
+func groupKeeper(g FileGroup, strategy KeepStrategy) FileGroupMember {
+	members := g.AllMembers()
+
+	var files []FileGroupMember
+	for _, m := range members {
+		if m.Type != MemberSymlink {
+			files = append(files, m)
+		}
+	}
+	if len(files) == 0 {
+		files = members
+	}
+
+	return bestKeeper(files, strategy)
+}
+
+// Returns whether the provided members are equally good keepers for the strategy, regardless of
+// their paths. The lexical strategy never ties, since paths are unique.
+func ties(a, b FileGroupMember, strategy KeepStrategy) bool {
+	switch strategy {
+	case KeepOldest, KeepNewest:
+		return a.ModTime.Equal(b.ModTime)
+	case KeepShallowest:
+		return depth(a.Path) == depth(b.Path)
+	}
+	return false
+}
+
+// Returns whether the provided member is a better keeper than the current one.
+func keepsBefore(m, current FileGroupMember, strategy KeepStrategy) bool {
+	switch strategy {
+	case KeepOldest:
+		if !m.ModTime.Equal(current.ModTime) {
+			return m.ModTime.Before(current.ModTime)
+		}
+	case KeepNewest:
+		if !m.ModTime.Equal(current.ModTime) {
+			return m.ModTime.After(current.ModTime)
+		}
+	case KeepShallowest:
+		if a, b := depth(m.Path), depth(current.Path); a != b {
+			return a < b
+		}
+	}
+	return m.Path < current.Path
+}
+
+func depth(path string) int {
+	return strings.Count(filepath.Clean(path), string(filepath.Separator))
+}
+
+// Checks if the provided path is one of the protected roots or below one.
+func isProtected(path string, protected []string) bool {
+	path = filepath.Clean(path)
+	for _, root := range protected {
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the bytes freed by deleting the deletable members of the provided action, where members
+// sharing an inode with the keeper or each other (hardlinks) free nothing or only once.
+func reclaimableBytes(action CleanupAction, size int64) int64 {
+	type inode struct{ dev, ino uint64 }
+	seen := map[inode]bool{{action.Keeper.Dev, action.Keeper.Ino}: true}
+
+	var bytes int64
+	for _, m := range action.Delete {
+		if m.Dev != 0 || m.Ino != 0 {
+			id := inode{m.Dev, m.Ino}
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+		}
+		bytes += size
+	}
+	return bytes
+}
+
+// Writes a shell script to the provided writer deleting all but the keeper of each of the provided
+// groups, which is picked with the provided strategy (statting the paths for their modification
+// times if needed) and noted as a comment. Nothing is deleted, the script can be reviewed and run
+// manually. Paths are single-quoted, so spaces, quotes and other special characters are safe.
+func WriteDeleteScript(groups [][]string, w io.Writer, keep KeepStrategy) error {
+	if keep < KeepLexical || keep > KeepShallowest {
+		return fmt.Errorf("invalid keep strategy: %d", keep)
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("#!/bin/sh\n# Deletes the duplicates found by filecollate, review before running.\n")
+
+	for _, paths := range groups {
+		if len(paths) < 2 {
+			continue
+		}
+
+		members := make([]FileGroupMember, len(paths))
+		for i, path := range paths {
+			members[i].Path = path
+			if keep == KeepOldest || keep == KeepNewest {
+				fi, err := os.Lstat(path)
+				if err != nil {
+					return err
+				}
+				members[i].ModTime = fi.ModTime()
+			}
+		}
+
+		keeper := bestKeeper(members, keep)
+
+		// Quoted like a Go string, so a newline in the path can't end the comment.
+		fmt.Fprintf(bw, "\n# keep %s\n", strconv.Quote(keeper.Path))
+		for _, m := range members {
+			if m.Path != keeper.Path {
+				fmt.Fprintf(bw, "rm -- %s\n", shellQuote(m.Path))
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// Quotes the provided string for a POSIX shell, where nothing is special within single quotes
+// except the single quote itself.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,240 @@
+package filecollate
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanCleanup(t *testing.T) {
+	now := time.Now()
+	group := FileGroup{
+		Key:       "key",
+		GroupSize: 10,
+		Members: []FileGroupMember{
+			{Path: "/backup/old/a.txt", ModTime: now.Add(-time.Hour), Dev: 1, Ino: 1},
+			{Path: "/photos/a.txt", ModTime: now, Dev: 1, Ino: 2},
+			{Path: "/photos/sub/a.txt", ModTime: now, Dev: 1, Ino: 2}, // hardlink of /photos/a.txt
+			{Path: "/mnt/usb/a.txt", ModTime: now, Dev: 2, Ino: 1},
+		},
+	}
+
+	paths := func(members []FileGroupMember) []string {
+		var paths []string
+		for _, m := range members {
+			paths = append(paths, m.Path)
+		}
+		return paths
+	}
+
+	tests := []struct {
+		name        string
+		opts        CleanupOptions
+		keeper      string
+		deletable   []string
+		protected   []string
+		skipped     []string
+		reclaimable int64
+	}{
+		{
+			name:        "lexical",
+			keeper:      "/backup/old/a.txt",
+			deletable:   []string{"/photos/a.txt", "/photos/sub/a.txt", "/mnt/usb/a.txt"},
+			reclaimable: 20,
+		},
+		{
+			name:        "shallowest",
+			opts:        CleanupOptions{Keep: KeepShallowest},
+			keeper:      "/photos/a.txt",
+			deletable:   []string{"/backup/old/a.txt", "/photos/sub/a.txt", "/mnt/usb/a.txt"},
+			reclaimable: 20,
+		},
+		{
+			name:        "protected",
+			opts:        CleanupOptions{ProtectedRoots: []string{"/photos/"}, Keep: KeepOldest},
+			keeper:      "/photos/a.txt",
+			deletable:   []string{"/backup/old/a.txt", "/mnt/usb/a.txt"},
+			protected:   []string{"/photos/sub/a.txt"},
+			reclaimable: 20,
+		},
+		{
+			name:        "same device",
+			opts:        CleanupOptions{Keep: KeepOldest, SameDevice: true},
+			keeper:      "/backup/old/a.txt",
+			deletable:   []string{"/photos/a.txt", "/photos/sub/a.txt"},
+			skipped:     []string{"/mnt/usb/a.txt"},
+			reclaimable: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		plan, err := PlanCleanup([]FileGroup{group}, tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		a := plan.Actions[0]
+		if a.Keeper.Path != tt.keeper ||
+			!reflect.DeepEqual(paths(a.Delete), tt.deletable) ||
+			!reflect.DeepEqual(paths(a.Protected), tt.protected) ||
+			!reflect.DeepEqual(paths(a.Skipped), tt.skipped) ||
+			plan.ReclaimableBytes != tt.reclaimable {
+			t.Errorf("%s: unexpected plan %+v with %d reclaimable bytes", tt.name, a, plan.ReclaimableBytes)
+		}
+	}
+
+	group.Members[3].Dev = 0
+	if _, err := PlanCleanup([]FileGroup{group}, CleanupOptions{SameDevice: true}); !errors.Is(err, ErrNoDeviceInfo) {
+		t.Errorf("Expected ErrNoDeviceInfo, got %v", err)
+	}
+}
+
+func TestPlanCleanupSymlinks(t *testing.T) {
+	group := FileGroup{
+		Key:       "key",
+		GroupSize: 10,
+		Members: []FileGroupMember{
+			{Path: "/a/link.txt", Dev: 1, Ino: 1, Type: MemberSymlink},
+			{Path: "/b/a.txt", Dev: 1, Ino: 1},
+			{Path: "/c/a.txt", Dev: 1, Ino: 2},
+		},
+	}
+
+	plan, err := PlanCleanup([]FileGroup{group}, CleanupOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := plan.Actions[0]
+	if a.Keeper.Path != "/b/a.txt" || len(a.Delete) != 1 || a.Delete[0].Path != "/c/a.txt" {
+		t.Errorf("Expected /b/a.txt to be kept and /c/a.txt to be deleted, got %+v", a)
+	}
+	if len(a.Links) != 1 || a.Links[0].Path != "/a/link.txt" {
+		t.Errorf("Expected the symlink to be kept, got %+v", a.Links)
+	}
+	if plan.ReclaimableBytes != 10 {
+		t.Errorf("Expected 10 reclaimable bytes, got %d", plan.ReclaimableBytes)
+	}
+}
+
+func TestPlanCleanupResolveKeeper(t *testing.T) {
+	now := time.Now()
+	groups := []FileGroup{
+		{
+			Key:       "clear",
+			GroupSize: 10,
+			Members: []FileGroupMember{
+				{Path: "/a/x.txt", ModTime: now, Ino: 1},
+				{Path: "/b/x.txt", ModTime: now.Add(-time.Hour), Ino: 2},
+			},
+		},
+		{
+			Key:       "tied",
+			GroupSize: 10,
+			Members: []FileGroupMember{
+				{Path: "/a/y.txt", ModTime: now, Ino: 3},
+				{Path: "/b/y.txt", ModTime: now, Ino: 4},
+				{Path: "/c/y.txt", ModTime: now.Add(time.Hour), Ino: 5},
+			},
+		},
+		{
+			Key:       "skipped",
+			GroupSize: 10,
+			Members: []FileGroupMember{
+				{Path: "/a/z.txt", ModTime: now, Ino: 6},
+				{Path: "/b/z.txt", ModTime: now, Ino: 7},
+			},
+		},
+	}
+
+	var asked [][]string
+	opts := CleanupOptions{
+		Keep: KeepOldest,
+		ResolveKeeper: func(group []FileGroupMember) (int, error) {
+			var paths []string
+			for _, m := range group {
+				paths = append(paths, m.Path)
+			}
+			asked = append(asked, paths)
+			if group[0].Path == "/a/z.txt" {
+				return 0, errors.New("undecided")
+			}
+			return 1, nil
+		},
+	}
+
+	plan, err := PlanCleanup(groups, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedAsked := [][]string{{"/a/y.txt", "/b/y.txt"}, {"/a/z.txt", "/b/z.txt"}}
+	if !reflect.DeepEqual(asked, expectedAsked) {
+		t.Errorf("Expected to be asked for %v, got %v", expectedAsked, asked)
+	}
+	if len(plan.Actions) != 2 || plan.Actions[0].Keeper.Path != "/b/x.txt" || plan.Actions[1].Keeper.Path != "/b/y.txt" {
+		t.Errorf("Expected /b/x.txt and the resolved /b/y.txt to be kept, got %+v", plan.Actions)
+	}
+	if !reflect.DeepEqual(plan.Unresolved, []string{"skipped"}) {
+		t.Errorf("Expected the unresolved group to be skipped, got %v", plan.Unresolved)
+	}
+
+	opts.ResolveKeeper = func([]FileGroupMember) (int, error) { return 5, nil }
+	if _, err := PlanCleanup(groups, opts); err == nil {
+		t.Error("Expected an error for an out of range keeper index")
+	}
+}
+
+func TestWriteDeleteScript(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("No shell to run the script:", err)
+	}
+
+	root := t.TempDir()
+	paths := writeFiles(t, root,
+		[2]string{"a keeper.txt", "dupe"},
+		[2]string{"it's a copy.txt", "dupe"},
+		[2]string{"x$(touch pwned)", "dupe"},
+		[2]string{"new\nline", "dupe"},
+	)
+
+	var script bytes.Buffer
+	if err := WriteDeleteScript([][]string{paths, {paths[0]}}, &script, KeepLexical); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(script.String(), "# keep "+strconv.Quote(paths[0])) {
+		t.Errorf("Expected the keeper as a comment, got:\n%s", script.String())
+	}
+
+	cmd := exec.Command(sh, "-s")
+	cmd.Stdin = &script
+	cmd.Dir = root
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Script failed: %v\n%s", err, out)
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != filepath.Base(paths[0]) {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("Expected only the keeper %s to remain, got %q", paths[0], names)
+	}
+
+	if err := WriteDeleteScript(nil, &script, KeepStrategy(42)); err == nil {
+		t.Error("Expected an error for an invalid keep strategy")
+	}
+}
@@ -0,0 +1,130 @@
+package filecollate
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"golang.org/x/exp/slices"
+)
+
+// Result of CompareDirectories, all paths are relative to the compared directories and sorted.
+type DirComparison struct {
+	Identical []string // Files present in both directories with matching content.
+	Differing []string // Files present in both directories with differing content.
+	OnlyInA   []string // Files only present in the first directory.
+	OnlyInB   []string // Files only present in the second directory.
+}
+
+// Compares the files of two copies of a tree by their relative paths, using the key generated by the
+// configured KeyGenerator to tell whether files present in both directories have matching content.
+// The Filters of the provided Cfg apply to both directories, while its Paths are ignored.
+func CompareDirectories(dirA, dirB string, c Cfg) (DirComparison, error) {
+	var cmp DirComparison
+
+	keysA, err := collectRelativeKeys(dirA, c)
+	if err != nil {
+		return cmp, err
+	}
+
+	keysB, err := collectRelativeKeys(dirB, c)
+	if err != nil {
+		return cmp, err
+	}
+
+	for rel, keyA := range keysA {
+		keyB, ok := keysB[rel]
+		switch {
+		case !ok:
+			cmp.OnlyInA = append(cmp.OnlyInA, rel)
+		case keyA == keyB:
+			cmp.Identical = append(cmp.Identical, rel)
+		default:
+			cmp.Differing = append(cmp.Differing, rel)
+		}
+	}
+
+	for rel := range keysB {
+		if _, ok := keysA[rel]; !ok {
+			cmp.OnlyInB = append(cmp.OnlyInB, rel)
+		}
+	}
+
+	slices.Sort(cmp.Identical)
+	slices.Sort(cmp.Differing)
+	slices.Sort(cmp.OnlyInA)
+	slices.Sort(cmp.OnlyInB)
+
+	return cmp, nil
+}
+
+// Returns the files of the candidate dir whose content also exists anywhere in the authoritative dir,
+// sorted by path, e.g. to tell which files of a copy are safe to delete. Only the keys of the
+// authoritative dir are held in memory while the candidate dir is streamed against them.
+//
+// The Filters and KeyGenerator of the provided Cfg apply to both dirs, while its Paths are ignored.
+// Overlapping dirs are rejected, since files would match themselves. To plan the deletion of the
+// matches with other constraints, use PlanCleanup with the authoritative dir as a protected root.
+func CompareDirs(authoritative, candidate string, c Cfg) ([]string, error) {
+	authoritative = filepath.Clean(sanitizePath(authoritative))
+	candidate = filepath.Clean(sanitizePath(candidate))
+	if isProtected(candidate, []string{authoritative}) || isProtected(authoritative, []string{candidate}) {
+		return nil, fmt.Errorf("overlapping dirs to compare: %s and %s", authoritative, candidate)
+	}
+
+	keys := make(map[string]struct{})
+	c.Paths = Paths{authoritative}
+	done := make(chan struct{})
+	err := run(context.Background(), c, func(fc *filecollate) {
+		defer close(done)
+		for p := range fc.pairs {
+			keys[p.key] = struct{}{}
+		}
+	})
+	<-done
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	c.Paths = Paths{candidate}
+	done = make(chan struct{})
+	err = run(context.Background(), c, func(fc *filecollate) {
+		defer close(done)
+		for p := range fc.pairs {
+			if _, ok := keys[p.key]; ok {
+				matches = append(matches, p.path)
+			}
+		}
+	})
+	<-done
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(matches)
+	return matches, nil
+}
+
+// Runs the search on the provided dir only and returns the generated keys mapped by the path of
+// each file relative to the dir.
+func collectRelativeKeys(dir string, c Cfg) (map[string]string, error) {
+	dir = sanitizePath(dir)
+	c.Paths = Paths{dir}
+
+	keys, err := collectKeys(c)
+	if err != nil {
+		return nil, err
+	}
+
+	relKeys := make(map[string]string, len(keys))
+	for path, key := range keys {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil, err
+		}
+		relKeys[rel] = key
+	}
+
+	return relKeys, nil
+}
@@ -0,0 +1,69 @@
+package filecollate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompareDirectories(t *testing.T) {
+	dirA, dirB := t.TempDir(), t.TempDir()
+	os.Mkdir(filepath.Join(dirA, "sub"), 0o755)
+	os.Mkdir(filepath.Join(dirB, "sub"), 0o755)
+
+	writeFiles(t, dirA,
+		[2]string{"same.txt", "same"},
+		[2]string{filepath.Join("sub", "changed.txt"), "before"},
+		[2]string{"a.txt", "only in a"},
+	)
+	writeFiles(t, dirB,
+		[2]string{"same.txt", "same"},
+		[2]string{filepath.Join("sub", "changed.txt"), "after"},
+		[2]string{"b.txt", "only in b"},
+	)
+
+	cmp, err := CompareDirectories(dirA, dirB, Cfg{Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := DirComparison{
+		Identical: []string{"same.txt"},
+		Differing: []string{filepath.Join("sub", "changed.txt")},
+		OnlyInA:   []string{"a.txt"},
+		OnlyInB:   []string{"b.txt"},
+	}
+
+	if !reflect.DeepEqual(cmp, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, cmp)
+	}
+}
+
+func TestCompareDirs(t *testing.T) {
+	authoritative, candidate := t.TempDir(), t.TempDir()
+	os.Mkdir(filepath.Join(authoritative, "sub"), 0o755)
+
+	writeFiles(t, authoritative,
+		[2]string{"a.txt", "a"},
+		[2]string{filepath.Join("sub", "b.txt"), "b"},
+	)
+	paths := writeFiles(t, candidate,
+		[2]string{"a-copy.txt", "a"},
+		[2]string{"b.txt", "b"},
+		[2]string{"c.txt", "c"},
+	)
+
+	matches, err := CompareDirs(authoritative, candidate, Cfg{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(matches, paths[:2]) {
+		t.Errorf("Expected %v, got %v", paths[:2], matches)
+	}
+
+	if _, err := CompareDirs(authoritative, filepath.Join(authoritative, "sub"), Cfg{}); err == nil {
+		t.Error("Expected overlapping dirs to be rejected")
+	}
+}
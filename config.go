@@ -9,6 +9,9 @@ import (
 	"reflect"
 	"runtime"
 	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
 )
 
 // Satisfies the flag.Value interface, string values can be provided as a csv or space separated list.
@@ -32,13 +35,227 @@ type Cfg struct {
 	KeyGenerator KeyGeneratorFunc // Function to generate a key based on the file path.
 	Paths                         // List of paths to search in for files to collect/group.
 	Filters                       // Filters to apply when searching for files to group.
-	Workers      int              // Number of max workers to use for the search.
+	HashOptions                   // Options for the provided hash KeyGenerators.
+	Workers      int              // Number of workers hashing the files found by the search.
+
+	// Symlinks to follow while all others are left unfollowed, either as the exact path of the
+	// symlink, a filepath.Match glob of it (e.g. "photos/*-backup"), or the dir containing it. Like
+	// the Paths, relative entries are resolved against the working dir. Only symlinks to dirs are
+	// followed, and never into a dir already followed or containing the symlink itself (a loop).
+	// Files reachable both directly and through a followed symlink are reported twice, as
+	// duplicates of themselves.
+	FollowSymlinkPaths []string
+
+	// Dirs owned by the caller which are never searched, e.g. the quarantine or output dir of a
+	// cleanup inside the searched trees, so that files moved there aren't found again by the next
+	// search. Unlike the names of DirsExclude, these are paths, relative ones are resolved against
+	// the working dir. Like the dir filters, they only apply below the Paths.
+	OwnedDirs []string
+
+	// Reports symlinks to regular files as members of the group of their target instead of leaving
+	// them out, flagged as MemberSymlink in the detailed results so that they aren't mistaken for
+	// copies. Files found below a followed symlink are always flagged as MemberSymlink, since
+	// deleting them deletes the real file.
+	IncludeSymlinks bool
+
+	// Non-empty Paths are always resolved to absolute paths, while an empty path defaults to the
+	// relative "." and so yields result paths relative to the working dir. This resolves it to the
+	// absolute working dir too, so that all result paths stay valid regardless of the working dir of
+	// the caller.
+	AbsolutePaths bool
+
+	// Files smaller than this size (in bytes) are hashed directly in the walk instead of being
+	// dispatched to a worker, which avoids the scheduling overhead for tiny files. 0 disables it.
+	InlineHashThreshold int64
+
+	// Omits one file per group (the keeper) from the results, so that only the paths which are safe
+	// to delete are returned, with the same membership in the batch and streamed results. By default
+	// all of them include the original, so this is the single switch for whether it's part of the
+	// results. The keeper is the lexically smallest path of the group, which keeps the choice
+	// deterministic regardless of the order in which files were found.
+	ExcludeKeeper bool
+
+	// Marks the keeper of each group in the output of the WriteResults* funcs, picked with the
+	// KeepStrategy like PlanCleanup picks it (without protected roots), so that the reports tell
+	// downstream tools what to preserve. The pick only depends on the members, so it's the same in
+	// every format, and the keeper is always among the members reported with MaxPathsPerGroup. The
+	// search fails with ErrKeeperExcluded if ExcludeKeeper is set too.
+	MarkKeeper   bool
+	KeepStrategy KeepStrategy
+
+	// Database of keys mapped to the canonical path of a known file, e.g. from a prior scan of a
+	// master library. Any scanned file whose key matches an entry is reported as a duplicate of the
+	// canonical path, which is always the first path of its group (and the keeper, if excluded).
+	BaselineDB map[string]string
+
+	// Drops groups from the detailed results whose members' modification times span more than this
+	// duration, e.g. to only clean up copies made by accident close to each other. 0 disables it.
+	MaxModTimeSpread time.Duration
+	// Keeps the groups exceeding MaxModTimeSpread and flags them via FileGroup.ModTimeSpreadExceeded
+	// instead of dropping them.
+	FlagModTimeSpread bool
+
+	// Channel to receive Stats snapshots on every ProgressInterval (defaults to 500ms), which is
+	// closed after a final snapshot once the search completes. Snapshots are dropped while the
+	// receiver isn't ready, the final one after waiting for the receiver for one more interval, so
+	// only a receiver reading concurrently with the search is guaranteed to get it.
+	ProgressChan     chan<- Stats
+	ProgressInterval time.Duration
+
+	// Called on each transition between the phases of the search (see Phase) with a snapshot of
+	// the progress at the boundary, e.g. to show "Hashing candidates..." in a UI.
+	OnPhase func(phase Phase, stats Stats)
+
+	// Reuses the key of a file presented more than once during the search (e.g. overlapping roots)
+	// instead of generating it again, as long as its path, size and mtime are unchanged. The memo is
+	// bounded to 65536 keys and cleared once full.
+	MemoizeHashes bool
+
+	// Keys of files known to be unique from a prior run (see FindUnique), which are reused instead of
+	// hashing the files again as long as their path, size and mtime are unchanged. New files are still
+	// hashed and grouped with the known ones if they match. Only valid with the same KeyGenerator (and
+	// KeyPrefix, TagFunc) as the prior run, and a file modified without changing its size and mtime
+	// keeps its stale key.
+	KnownUnique map[FileIdentity]string
+
+	// Max num of files visited per directory, once exceeded the remainder of the directory is skipped
+	// and reported to OnSkipDir with SkipReasonMaxFiles. Only files passing the filters are counted.
+	// Protects broad scans against pathological directories. 0 means unlimited.
+	MaxFilesPerDir int
+
+	// Tags each file with external metadata (e.g. a rating from a sidecar file), which is combined
+	// into the generated key as "<key>|<tag>" so that only files sharing both are grouped. Errors are
+	// handled like key generator errors, ErrSkipFile skips the file and any other error is returned.
+	TagFunc func(path string) (string, error)
+
+	// Buffers the groups of StreamResults until the search completes, and then sends each complete
+	// group exactly once in the order of their keys, instead of sending them again whenever they grow.
+	// Trades immediacy for clean groups, no memory is freed on the receiving side until the search
+	// completes, since all groups are held back until then like with GetResults.
+	BufferStream bool
+
+	// Makes the streamed results reproducible across runs, e.g. for tests or diffable pipelines.
+	// The roots are walked one after another in the order of the Paths, each depth-first with the
+	// entries of every dir in lexical order (like filepath.WalkDir), and every file is hashed right
+	// in the walk, so that groups are sent in the order their files were found. This overrides
+	// Workers to 1, so nothing is hashed concurrently and large scans get much slower. Unlike
+	// BufferStream, groups are still sent as soon as they grow.
+	OrderedStream bool
+
+	// Prepended to every generated key, so that results of scans of different sources (e.g. volumes)
+	// stay distinguishable once merged into one map or Index. Usually only useful for name-based keys,
+	// with content hashes a prefix prevents matching files across sources. Keys of the BaselineDB must
+	// include the prefix to match.
+	KeyPrefix string
+
+	// Picks the KeyGenerator of each file based on its info, e.g. a sampled hash for files over 1GB
+	// and a full hash otherwise, falling back to KeyGenerator if it returns nil. The HashOptions are
+	// applied to the picked generator as well. It runs on the hot path (once per file, concurrently),
+	// so it should be cheap and safe for concurrent use. Keys of different generators must not
+	// collide unless the files are meant to be grouped.
+	SelectKeyGenerator func(path string, fi os.FileInfo) KeyGeneratorFunc
+
+	// Keys files on a sha256 hash of their size and their first and last 4KB only, replacing the
+	// KeyGenerator and SelectKeyGenerator of the search, which is as fast as it gets for large files
+	// but accepts false positives. The search fails with ErrCollisionRiskUnacknowledged unless
+	// AcknowledgeCollisionRisk is set too, as a barrier against acting on such results by accident.
+	//
+	// Two different files only share a key by chance with a probability of about n²/2^257 for n
+	// files, which is negligible, since sha256 is collision resistant. The real risk is the data
+	// itself: files of the same size that only differ between their first and last 4KB always share
+	// a key, e.g. disk images, databases or edited media with unchanged headers and trailers. So the
+	// false positive rate depends entirely on the kind of files, and results should be verified
+	// (e.g. with VerifyGroups and a full hash) before anything is deleted.
+	FastUnsafe               bool
+	AcknowledgeCollisionRisk bool
+
+	// By default, files that vanish between being found and being hashed (common in active dirs) are
+	// skipped and reported to OnError, this aborts the search with the fs.ErrNotExist error instead.
+	FailOnVanishedFiles bool
+
+	// Fails the search with ErrNoFilesMatched if the walk of the Paths completed without a single
+	// file passing the filters, which is likely a mistake in the filters rather than a tree without
+	// duplicates.
+	ErrorOnNoMatch bool
+
+	// Receives non-fatal errors that caused a file to be skipped. It's called from the worker
+	// goroutines, so it must be safe for concurrent use.
+	OnError func(path string, err error)
+
+	// Max num of paths in groups (including the keepers) collected in the results, once reached the
+	// search is stopped and the results collected so far are returned with ErrResultsTruncated (and
+	// Summary.Truncated), which protects consumers that allocate per path. 0 means unlimited.
+	MaxResultPaths int
+
+	// Max num of members reported per group in the detailed results, the members of larger groups
+	// are sorted by path and those beyond the first N are moved to FileGroup.Omitted, which keeps
+	// reports readable when a file has hundreds of copies. FileGroup.TotalMembers still tells the
+	// true size of the group, and the aggregations and PlanCleanup consider all members. With
+	// MarkKeeper, the keeper takes the place of the last of the first N if it's beyond them. 0 means
+	// unlimited.
+	MaxPathsPerGroup int
+
+	// Leaves groups without a file of at least this size (in bytes) out of the results, while all
+	// files are still hashed, e.g. to only report duplicates of big files when the keys are reused for
+	// other reports (see MemoizeHashes and KnownUnique). It applies to whole groups, so a group with a
+	// big enough member is reported with all its members, even if a KeyGenerator ignoring the size
+	// groups files of different sizes. The members are only collected (and streamed) once the group
+	// has such a member. 0 reports all groups.
+	MinReportSize int64
+
+	// Max duration of the search, once exceeded it's shut down gracefully and the partial results
+	// are returned with ErrTimeBudgetExceeded. Useful for scheduled jobs with a maintenance window.
+	MaxDuration time.Duration
+
+	// Called exactly once for every directory skipped by the filters (or MaxFilesPerDir) with the
+	// reason and the matching pattern, if any, e.g. to debug why a whole folder was skipped. Skipped
+	// directories are counted in Stats and Summary regardless.
+	OnSkipDir func(path string, reason SkipReason, pattern string)
+
+	// Max num of concurrent reads per physical device, keyed by any path on the device (e.g. its
+	// mount point or one of the Paths), with DefaultDeviceConcurrency applying to the devices not
+	// listed (0 for no limit). Useful to prevent seek thrashing on HDDs while SSDs are read by all
+	// workers. The search fails if a path doesn't exist or two paths on the same device have
+	// different limits. Reads are never limited where device info is unavailable (not Unix).
+	PerDeviceConcurrency     map[string]int
+	DefaultDeviceConcurrency int
+
+	// Retries files failing with a network error (e.g. a timeout of a network mount) with a backoff,
+	// then reports and skips them, stopping the search with ErrMountUnavailable once too many files
+	// of a device failed in a row. Without a policy, network errors fail the search like any other.
+	NetworkErrorPolicy *NetworkErrorPolicy
+
+	// Max num of files opened at once for hashing, by the workers and walks of a search as well as
+	// by VerifyGroups, e.g. to stay below the file descriptor limit of the process. 0 means
+	// unlimited.
+	MaxOpenFiles int
+
+	// Yields to other workloads of the system (e.g. of a background daemon), by halving the num of
+	// files hashed at once while the 1 minute load average exceeds the TargetLoad and raising it by
+	// one again once it dropped below 3/4 of it, up to the Workers. The load is sampled at most once
+	// a second when a file is hashed.
+	//
+	// The load average is a coarse signal: it lags behind by design, includes the search's own
+	// hashing as well as processes waiting on I/O, and doesn't tell CPU and disk contention apart, so
+	// the concurrency adapts over tens of seconds and a search may settle below its share. Only
+	// supported on Linux (/proc/loadavg), elsewhere it's a no-op.
+	LoadAware  bool
+	TargetLoad float64 // Defaults to the num of CPUs if 0.
+
+	// Makes RevalidateGroup compare the members still sharing a key byte-for-byte with the first of
+	// them, and drop those that differ, so that a collision of a partial or weak hash (e.g. of
+	// Crc32HashKeyGenerator) can't pass the check. Reads every member entirely.
+	RevalidateBytes bool
+
+	// Walks the paths one after another and hashes every file inline, so that pairs are produced and
+	// consumed in walk order and results are reproducible across runs. Set by OrderedStream, and by
+	// tests to keep the Workers.
+	deterministic bool
 }
 
 // Beauty stringifies the Cfg struct.
 func (c *Cfg) String() string {
-	keygenFn := runtime.FuncForPC(reflect.ValueOf(c.KeyGenerator).Pointer())
-	keygenFnName := filepath.Base(keygenFn.Name())
+	keygenFnName := funcName(c.KeyGenerator)
 
 	return fmt.Sprintf(
 		"\n{\n\tPath: %s\n\tFilters: \n%s\n\tKeyGenerator: %s\n}",
@@ -48,6 +265,86 @@ func (c *Cfg) String() string {
 	)
 }
 
+// Snapshot of the effective settings of a search once the defaults are applied, as returned by
+// Cfg.Resolved. Only contains plain values, so it can be serialized, e.g. to JSON for bug reports.
+type ResolvedCfg struct {
+	Paths        []string
+	Filters      Filters // With the extensions of the MediaPreset added to ExtInclude.
+	KeyGenerator string  // Name of the KeyGeneratorFunc, e.g. "filecollate.Crc32HashKeyGenerator".
+	HashOptions  HashOptions
+
+	Workers             int
+	JobsBuffer          int // Num of found files buffered for the workers.
+	PairsBuffer         int // Num of generated keys buffered for the collection of the results.
+	InlineHashThreshold int64
+	ProgressInterval    time.Duration
+	MaxDuration         time.Duration
+	MaxFilesPerDir      int
+	MemoizeHashes       bool
+	ExcludeKeeper       bool
+	KeyPrefix           string
+}
+
+// Returns the effective settings of a search with the Cfg after the defaults are applied, e.g. to
+// confirm that the Cfg is interpreted as intended. The Cfg itself is left untouched.
+func (c Cfg) Resolved() ResolvedCfg {
+	c.Paths = slices.Clone(c.Paths) // Defaults are applied to the paths in place
+	c.defaults()
+
+	return ResolvedCfg{
+		Paths:               c.Paths,
+		Filters:             c.Filters,
+		KeyGenerator:        funcName(c.KeyGenerator),
+		HashOptions:         c.HashOptions,
+		Workers:             c.Workers,
+		JobsBuffer:          c.Workers * jobsPerWorker,
+		PairsBuffer:         c.Workers,
+		InlineHashThreshold: c.InlineHashThreshold,
+		ProgressInterval:    c.ProgressInterval,
+		MaxDuration:         c.MaxDuration,
+		MaxFilesPerDir:      c.MaxFilesPerDir,
+		MemoizeHashes:       c.MemoizeHashes,
+		ExcludeKeeper:       c.ExcludeKeeper,
+		KeyPrefix:           c.KeyPrefix,
+	}
+}
+
+// Returns the name of the provided func including its package, e.g. "filecollate.Crc32HashKeyGenerator".
+func funcName(fn KeyGeneratorFunc) string {
+	return filepath.Base(runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name())
+}
+
+// Returns the provided paths cleaned, so that they match the paths presented during the search.
+func cleanPaths(paths []string) []string {
+	cleaned := make([]string, len(paths))
+	for i, path := range paths {
+		cleaned[i] = filepath.Clean(path)
+	}
+	return cleaned
+}
+
+// Returns the provided paths resolved to absolute paths like the Paths.
+func absPaths(paths []string) []string {
+	resolved := make([]string, len(paths))
+	for i, path := range paths {
+		resolved[i] = sanitizePath(path)
+	}
+	return resolved
+}
+
+// Returns the set of the provided paths resolved to absolute paths, nil if there are none.
+func absPathSet(paths []string) map[string]bool {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	set := make(map[string]bool, len(paths))
+	for _, path := range absPaths(paths) {
+		set[path] = true
+	}
+	return set
+}
+
 // Sanitizes the provided path, supports ~ and ~username.
 func sanitizePath(path string) string {
 	if strings.HasPrefix(path, "~") {
@@ -83,18 +380,37 @@ func sanitizePath(path string) string {
 func (c *Cfg) defaults() {
 	for i, path := range c.Paths {
 		if path == "" {
-			c.Paths[i] = "." // Default to current directory
-			continue
+			path = "." // Default to current directory
+		} else {
+			path = sanitizePath(path)
+		}
+
+		if c.AbsolutePaths {
+			if abs, err := filepath.Abs(path); err == nil {
+				path = abs
+			}
 		}
 
-		c.Paths[i] = sanitizePath(path)
+		c.Paths[i] = path
+	}
+
+	if c.MediaPreset != 0 {
+		c.ExtInclude = append(slices.Clip(c.ExtInclude), c.MediaPreset.extensions()...)
 	}
 
 	if c.KeyGenerator == nil {
 		c.KeyGenerator = Crc32HashKeyGenerator // Default to CRC32 (fast and sufficient for most cases)
 	}
 
-	if c.Workers == 0 {
-		c.Workers = runtime.GOMAXPROCS(0) / 2
+	if c.ProgressInterval <= 0 {
+		c.ProgressInterval = 500 * time.Millisecond
+	}
+
+	if c.OrderedStream {
+		c.Workers, c.deterministic = 1, true
+	}
+
+	if c.Workers <= 0 {
+		c.Workers = max(1, runtime.GOMAXPROCS(0)/2) // At least one worker must consume the found files
 	}
 }
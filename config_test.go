@@ -2,9 +2,13 @@ package filecollate
 
 import (
 	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"testing"
+	"time"
+
+	"golang.org/x/exp/slices"
 )
 
 func TestSanitizePath(t *testing.T) {
@@ -41,7 +45,7 @@ func TestDefaults(t *testing.T) {
 		t.Error("Expected key generator to be set to default: Crc32HashKeyGenerator")
 	}
 
-	defaultWorkers := runtime.GOMAXPROCS(0) / 2
+	defaultWorkers := max(1, runtime.GOMAXPROCS(0)/2)
 	if cfg.Workers != defaultWorkers {
 		t.Errorf("Expected workers to be set to default: %d", defaultWorkers)
 	}
@@ -59,3 +63,61 @@ func TestDefaults(t *testing.T) {
 		t.Errorf("Expected key generator to be set to Sha256HashKeyGenerator")
 	}
 }
+
+func TestDefaultsMediaPreset(t *testing.T) {
+	cfg := &Cfg{Filters: Filters{ExtInclude: []string{".txt"}, MediaPreset: Images | Audio}}
+	cfg.defaults()
+
+	for _, ext := range []string{".txt", ".jpg", ".heic", ".flac"} {
+		if cfg.Filters.skipFile("file" + ext) {
+			t.Errorf("Expected %s files to be included", ext)
+		}
+	}
+
+	if !cfg.Filters.skipFile("file.mp4") {
+		t.Error("Expected .mp4 files to be skipped without the Videos preset")
+	}
+}
+
+func TestDefaultsAbsolutePaths(t *testing.T) {
+	cfg := &Cfg{Paths: []string{"", "photos"}, AbsolutePaths: true}
+	cfg.defaults()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Paths{wd, filepath.Join(wd, "photos")}
+	if !reflect.DeepEqual(cfg.Paths, expected) {
+		t.Errorf("Expected %v, got %v", expected, cfg.Paths)
+	}
+
+	// Only the empty path stays relative without it.
+	cfg = &Cfg{Paths: []string{"", "photos"}}
+	cfg.defaults()
+
+	expected = Paths{".", filepath.Join(wd, "photos")}
+	if !reflect.DeepEqual(cfg.Paths, expected) {
+		t.Errorf("Expected %v without AbsolutePaths, got %v", expected, cfg.Paths)
+	}
+}
+
+func TestResolved(t *testing.T) {
+	cfg := Cfg{Paths: []string{""}, Workers: 3, Filters: Filters{MediaPreset: Audio}}
+	resolved := cfg.Resolved()
+
+	if resolved.KeyGenerator != "filecollate.Crc32HashKeyGenerator" {
+		t.Errorf("Expected the default key generator, got %s", resolved.KeyGenerator)
+	}
+	if resolved.Workers != 3 || resolved.JobsBuffer != 3*jobsPerWorker || resolved.ProgressInterval != 500*time.Millisecond {
+		t.Errorf("Unexpected resolved settings %+v", resolved)
+	}
+	if !slices.Contains(resolved.Filters.ExtInclude, ".flac") || !reflect.DeepEqual(resolved.Paths, []string{"."}) {
+		t.Errorf("Expected the resolved paths and filters, got %+v", resolved)
+	}
+
+	if cfg.Paths[0] != "" || cfg.KeyGenerator != nil || len(cfg.ExtInclude) != 0 {
+		t.Errorf("Expected the Cfg to be left untouched, got %+v", cfg)
+	}
+}
@@ -0,0 +1,69 @@
+package filecollate
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+)
+
+// Max num of decompressed bytes hashed by DecompressedHashKeyGenerator, beyond which the raw
+// contents are hashed instead, so that a zip bomb can't keep a worker busy forever.
+const maxDecompressedSize = 4 << 30
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Generates a sha256 hash of the decompressed contents of compressed files as the key, so that
+// files with the same contents compressed with different settings (or tools) share the same key.
+// Supported formats are detected by their magic bytes rather than their extension:
+//
+//   - gzip, including concatenated multi-member streams
+//
+// Other files, corrupt streams, and streams decompressing to more than 4GB are hashed like with
+// FullSha256HashKeyGenerator. Keys of decompressed contents are prefixed with the format (e.g.
+// "gzip:"), so a compressed file never shares the key of an uncompressed copy of its contents.
+func DecompressedHashKeyGenerator(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	magic, err := r.Peek(len(gzipMagic))
+	if err != nil || !bytes.Equal(magic, gzipMagic) {
+		return FullSha256HashKeyGenerator(path)
+	}
+
+	key, err := hashGzip(r)
+	if err != nil {
+		// Corrupt or too large, compare the raw bytes instead. Read errors surface again there.
+		return FullSha256HashKeyGenerator(path)
+	}
+	return "gzip:" + key, nil
+}
+
+var errDecompressedTooLarge = errors.New("decompressed contents too large")
+
+func hashGzip(r io.Reader) (string, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, io.LimitReader(zr, maxDecompressedSize+1))
+	if err != nil {
+		return "", err
+	}
+	if n > maxDecompressedSize {
+		return "", errDecompressedTooLarge
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
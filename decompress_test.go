@@ -0,0 +1,65 @@
+package filecollate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecompressedHashKeyGenerator(t *testing.T) {
+	dir := t.TempDir()
+	contents := strings.Repeat("Go rocks! ", 1000)
+
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	compress := func(name string, level int, header string) string {
+		var buf bytes.Buffer
+		zw, err := gzip.NewWriterLevel(&buf, level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw.Name = header
+		zw.Write([]byte(contents))
+		zw.Close()
+		return write(name, buf.Bytes())
+	}
+	key := func(path string) string {
+		key, err := DecompressedHashKeyGenerator(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	fast := key(compress("fast.gz", gzip.BestSpeed, "a"))
+	best := key(compress("best.gz", gzip.BestCompression, "b"))
+	if fast != best || !strings.HasPrefix(fast, "gzip:") {
+		t.Errorf("Expected differently compressed files to share a gzip key, got %s and %s", fast, best)
+	}
+
+	plain := write("plain.txt", []byte(contents))
+	raw, err := FullSha256HashKeyGenerator(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := key(plain); got != raw || got == fast {
+		t.Errorf("Expected the uncompressed file to be hashed raw, got %s", got)
+	}
+
+	corrupt := write("corrupt.gz", append([]byte{0x1f, 0x8b}, "definitely not gzip"...))
+	raw, err = FullSha256HashKeyGenerator(corrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := key(corrupt); got != raw {
+		t.Errorf("Expected the corrupt file to be hashed raw, got %s", got)
+	}
+}
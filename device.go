@@ -0,0 +1,89 @@
+package filecollate
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Limits the num of concurrent reads per physical device, so that HDDs aren't thrashed by seeks
+// while SSDs can still be read by all workers at once.
+type deviceLimiter struct {
+	limits       map[uint64]int // device -> max concurrent reads
+	defaultLimit int            // for devices without a limit, 0 for no limit
+
+	mu   sync.Mutex
+	sems map[uint64]chan struct{} // device -> semaphore, nil if unlimited
+}
+
+// Returns nil if no limits are configured, which disables limiting altogether. The limits are keyed
+// by a path on each device, which is resolved to its device once here. Fails if a path can't be
+// stat'ed or two paths on the same device have different limits. Paths without device info (not
+// Unix) are ignored, since reads are never limited there.
+func newDeviceLimiter(limits map[string]int, defaultLimit int) (*deviceLimiter, error) {
+	if len(limits) == 0 && defaultLimit <= 0 {
+		return nil, nil
+	}
+
+	devLimits := make(map[uint64]int, len(limits))
+	for path, limit := range limits {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid per-device concurrency: %w", err)
+		}
+
+		dev, _ := fileID(fi)
+		if dev == 0 {
+			continue
+		}
+		if prev, ok := devLimits[dev]; ok && prev != limit {
+			return nil, fmt.Errorf("invalid per-device concurrency: conflicting limits %d and %d for the device of %s", prev, limit, path)
+		}
+		devLimits[dev] = limit
+	}
+
+	return &deviceLimiter{
+		limits:       devLimits,
+		defaultLimit: defaultLimit,
+		sems:         make(map[uint64]chan struct{}),
+	}, nil
+}
+
+// Blocks until a read on the provided device is allowed, the returned func must be called once the
+// read is done. Reads on an unknown device (0, where device info is unavailable) are never limited.
+func (l *deviceLimiter) acquire(dev uint64) (release func()) {
+	if l == nil || dev == 0 {
+		return func() {}
+	}
+
+	sem := l.semaphore(dev)
+	if sem == nil {
+		return func() {}
+	}
+
+	sem <- struct{}{}
+	return func() { <-sem }
+}
+
+// Returns the semaphore of the provided device, creating it on first use.
+func (l *deviceLimiter) semaphore(dev uint64) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sem, ok := l.sems[dev]
+	if ok {
+		return sem
+	}
+
+	limit, ok := l.limits[dev]
+	if !ok {
+		limit = l.defaultLimit
+	}
+
+	if limit > 0 {
+		sem = make(chan struct{}, limit)
+	}
+	l.sems[dev] = sem
+
+	return sem
+}
@@ -0,0 +1,129 @@
+package filecollate
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeviceLimiter(t *testing.T) {
+	if l, err := newDeviceLimiter(nil, 0); l != nil || err != nil {
+		t.Fatalf("Expected nil limiter without limits, got %+v and %v", l, err)
+	}
+
+	dir := t.TempDir()
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, _ := fileID(fi)
+	if dev == 0 {
+		t.Skip("Device info unavailable on this platform")
+	}
+
+	const limit = 2
+	l, err := newDeviceLimiter(map[string]int{dir: limit}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := l.acquire(dev)
+			defer release()
+
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+		}()
+	}
+	wg.Wait()
+
+	if p := peak.Load(); p > limit {
+		t.Errorf("Expected at most %d concurrent reads, got %d", limit, p)
+	}
+
+	// Unlisted and unknown devices aren't limited.
+	if sem := l.semaphore(dev + 1); sem != nil {
+		t.Errorf("Expected no semaphore for an unlisted device")
+	}
+	l.acquire(0)()
+
+	// Paths that don't exist and conflicting limits for the same device fail.
+	if _, err := newDeviceLimiter(map[string]int{filepath.Join(dir, "missing"): 1}, 0); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected an error for a missing path, got %v", err)
+	}
+	path := writeFiles(t, dir, [2]string{"a.txt", "a"})[0]
+	if _, err := newDeviceLimiter(map[string]int{dir: 1, path: 2}, 0); err == nil {
+		t.Error("Expected an error for conflicting limits of the same device")
+	}
+	if _, err := newDeviceLimiter(map[string]int{dir: 1, path: 1}, 0); err != nil {
+		t.Errorf("Expected agreeing limits of the same device to be accepted, got %v", err)
+	}
+
+	// The search fails with an invalid limit.
+	if _, err := GetResults(Cfg{Paths: []string{dir}, PerDeviceConcurrency: map[string]int{filepath.Join(dir, "missing"): 1}}); err == nil {
+		t.Error("Expected the search to fail with a missing path")
+	}
+}
+
+func TestPerDeviceConcurrency(t *testing.T) {
+	dir := createSmallFilesTree(t, 2, 10)
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev, _ := fileID(fi); dev == 0 {
+		t.Skip("Device info unavailable on this platform")
+	}
+
+	var running, peak atomic.Int32
+	slowGenerator := func(path string) (string, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return Crc32HashKeyGenerator(path)
+	}
+
+	for _, c := range []Cfg{
+		{DefaultDeviceConcurrency: 1},
+		{PerDeviceConcurrency: map[string]int{dir: 1}}, // Keyed by a path on the device
+	} {
+		c.Paths, c.Workers, c.KeyGenerator = []string{dir}, 4, slowGenerator
+		peak.Store(0)
+
+		results, err := GetResults(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) == 0 {
+			t.Error("Expected duplicates with the device concurrency limited")
+		}
+
+		// All files are on the same device.
+		if p := peak.Load(); p != 1 {
+			t.Errorf("Expected a single file hashed at once, got %d", p)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package filecollate
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Runs the search and writes a Graphviz (DOT) graph of the duplicate relationships between
+// directories to the provided writer. Directories containing duplicates are the nodes, and each
+// edge connects two directories sharing copies of the same files, weighted by the shared bytes.
+//
+// With Cfg.MarkKeeper, directories containing the keeper of a group are drawn bold. Nodes and edges
+// are sorted, so the same results always produce the same graph.
+func WriteResultsDot(c Cfg, w io.Writer) error {
+	groups, err := GetDetailedResults(c)
+	if err != nil {
+		return err
+	}
+
+	type edge struct{ a, b string }
+	edges := make(map[edge]int64) // -> shared bytes
+	nodes := make(map[string]struct{})
+	keeperDirs := make(map[string]bool)
+
+	for _, g := range groups {
+		if keeper := markedKeeper(g, c); keeper != "" {
+			keeperDirs[filepath.Dir(keeper)] = true
+		}
+
+		dirs := make(map[string]struct{})
+		for _, m := range g.Members {
+			dirs[filepath.Dir(m.Path)] = struct{}{}
+		}
+
+		sorted := maps.Keys(dirs)
+		slices.Sort(sorted)
+
+		for i, a := range sorted {
+			nodes[a] = struct{}{}
+			for _, b := range sorted[i+1:] {
+				edges[edge{a, b}] += g.GroupSize
+			}
+		}
+	}
+
+	sortedNodes := maps.Keys(nodes)
+	slices.Sort(sortedNodes)
+
+	sortedEdges := maps.Keys(edges)
+	slices.SortFunc(sortedEdges, func(x, y edge) int {
+		if x.a != y.a {
+			return strings.Compare(x.a, y.a)
+		}
+		return strings.Compare(x.b, y.b)
+	})
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "graph duplicates {")
+	for _, node := range sortedNodes {
+		if keeperDirs[node] {
+			fmt.Fprintf(bw, "\t%s [style=bold];\n", dotQuote(node))
+		} else {
+			fmt.Fprintf(bw, "\t%s;\n", dotQuote(node))
+		}
+	}
+	for _, e := range sortedEdges {
+		fmt.Fprintf(bw, "\t%s -- %s [weight=%d, label=\"%d bytes\"];\n", dotQuote(e.a), dotQuote(e.b), edges[e], edges[e])
+	}
+	fmt.Fprintln(bw, "}")
+
+	return bw.Flush()
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// Quotes the provided string as a DOT ID, escaping only quotes and backslashes. Go quoting (%q)
+// doesn't fit, since Graphviz renders its \u and \x escapes literally.
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,70 @@
+package filecollate
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteResultsDot(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a", "b", "c"} {
+		os.Mkdir(filepath.Join(root, dir), 0o755)
+	}
+
+	writeFiles(t, root,
+		[2]string{filepath.Join("a", "one.txt"), "12345"},
+		[2]string{filepath.Join("b", "one.txt"), "12345"},
+		[2]string{filepath.Join("a", "two.txt"), "abc"},
+		[2]string{filepath.Join("b", "two.txt"), "abc"},
+		[2]string{filepath.Join("c", "two.txt"), "abc"},
+	)
+
+	cfg := Cfg{Paths: []string{root}, Workers: 4}
+
+	var buf bytes.Buffer
+	if err := WriteResultsDot(cfg, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	a, b, c := filepath.Join(root, "a"), filepath.Join(root, "b"), filepath.Join(root, "c")
+	expected := fmt.Sprintf(`graph duplicates {
+	%[1]q;
+	%[2]q;
+	%[3]q;
+	%[1]q -- %[2]q [weight=8, label="8 bytes"];
+	%[1]q -- %[3]q [weight=3, label="3 bytes"];
+	%[2]q -- %[3]q [weight=3, label="3 bytes"];
+}
+`, a, b, c)
+
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	// Must be deterministic across runs.
+	var again bytes.Buffer
+	if err := WriteResultsDot(cfg, &again); err != nil {
+		t.Fatal(err)
+	}
+
+	if again.String() != buf.String() {
+		t.Error("Expected identical graphs across runs")
+	}
+}
+
+func TestDotQuote(t *testing.T) {
+	tests := map[string]string{
+		"photos/été":       `"photos/été"`,
+		`say "hi"`:         `"say \"hi\""`,
+		`C:\Users\me`:      `"C:\\Users\\me"`,
+		"tab\tand emoji 📷": "\"tab\tand emoji 📷\"",
+	}
+	for s, expected := range tests {
+		if got := dotQuote(s); got != expected {
+			t.Errorf("%s: expected %s, got %s", s, expected, got)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+//go:build go1.23
+
+package filecollate
+
+import (
+	"context"
+	"iter"
+	"sync"
+)
+
+// Kind of an Event yielded by Events.
+type EventKind int
+
+const (
+	EventProgress  EventKind = iota + 1 // Progress snapshot of the search, see Event.Stats.
+	EventDuplicate                      // Group that grew, see Event.Group.
+	EventError                          // Non-fatal error of a file or the error of the search, see Event.Err.
+)
+
+// Event of a search yielded by Events, only the fields of its Kind are set.
+type Event struct {
+	Kind  EventKind
+	Stats Stats    // Progress, like sent to Cfg.ProgressChan.
+	Group []string // Complete membership of the group so far, like sent by StreamResults.
+	Path  string   // File that caused the error, empty for the error of the search itself.
+	Err   error
+}
+
+// Events runs the search and yields its progress, duplicates and errors interleaved as a single
+// sequence, e.g. to drive a TUI with one range loop. The search starts once the range starts, and
+// stopping the range cancels the search and waits for it to shut down.
+//
+// The ProgressChan of the provided Cfg is replaced to yield the progress, while its OnError is still
+// called besides yielding the errors. A failed search yields its error as the last event.
+func Events(ctx context.Context, c Cfg) iter.Seq[Event] {
+	return func(yield func(Event) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// Closed once the range stops, the provided ctx being done must not drop the final error.
+		events, stopped := make(chan Event), make(chan struct{})
+		send := func(ev Event) {
+			select {
+			case events <- ev:
+			case <-stopped:
+			}
+		}
+
+		progress := make(chan Stats)
+		groups := make(chan []string)
+		c.ProgressChan = progress
+
+		onError := c.OnError
+		c.OnError = func(path string, err error) {
+			if onError != nil {
+				onError(path, err)
+			}
+			send(Event{Kind: EventError, Path: path, Err: err})
+		}
+
+		var forwarders sync.WaitGroup
+		forwarders.Add(2)
+		go func() {
+			defer forwarders.Done()
+			for stats := range progress {
+				send(Event{Kind: EventProgress, Stats: stats})
+			}
+		}()
+		go func() {
+			defer forwarders.Done()
+			for group := range groups {
+				send(Event{Kind: EventDuplicate, Group: group})
+			}
+		}()
+
+		go func() {
+			defer close(events)
+			err := StreamResults(ctx, c, groups)
+			forwarders.Wait()
+			if err != nil {
+				events <- Event{Kind: EventError, Err: err} // Drained if the range was stopped
+			}
+		}()
+
+		for ev := range events {
+			if !yield(ev) {
+				close(stopped)
+				cancel()
+				for range events {
+					// Drain until the search has shut down.
+				}
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+//go:build go1.23
+
+package filecollate
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestEvents(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, [2]string{"a.txt", "dupe"}, [2]string{"b.txt", "dupe"}, [2]string{"c.txt", "dupe"})
+
+	kinds := make(map[EventKind]int)
+	var hashed int64
+	for ev := range Events(context.Background(), Cfg{Paths: []string{root}}) {
+		kinds[ev.Kind]++
+		hashed = max(hashed, ev.Stats.FilesHashed)
+	}
+
+	if kinds[EventDuplicate] != 2 || kinds[EventProgress] == 0 || kinds[EventError] != 0 {
+		t.Errorf("Expected 2 duplicate and some progress events, got %v", kinds)
+	}
+	if hashed != 3 {
+		t.Errorf("Expected a final progress snapshot of 3 hashed files, got %d", hashed)
+	}
+
+	// Stopping the range cancels the search.
+	tree := createSmallFilesTree(t, 20, 50)
+	seen := 0
+	for ev := range Events(context.Background(), Cfg{Paths: []string{tree}}) {
+		if ev.Kind == EventDuplicate {
+			seen++
+			break
+		}
+	}
+	if seen != 1 {
+		t.Errorf("Expected to stop after the first duplicate, got %d", seen)
+	}
+}
+
+func TestEventsCancelled(t *testing.T) {
+	tree := createSmallFilesTree(t, 20, 50)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var last Event
+	for ev := range Events(ctx, Cfg{Paths: []string{tree}}) {
+		if ev.Kind == EventDuplicate {
+			cancel()
+		}
+		last = ev
+	}
+	if last.Kind != EventError || !errors.Is(last.Err, context.Canceled) {
+		t.Errorf("Expected the cancellation of the search as the last event, got %+v", last)
+	}
+}
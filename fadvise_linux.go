@@ -0,0 +1,19 @@
+//go:build linux
+
+package filecollate
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Hints the kernel that the file will be read sequentially, which enables more aggressive read-ahead.
+func adviseSequential(file *os.File) {
+	_ = unix.Fadvise(int(file.Fd()), 0, 0, unix.FADV_SEQUENTIAL) // Only a hint, errors don't matter
+}
+
+// Hints the kernel that the file's pages won't be needed again, so they're dropped from the page cache.
+func adviseDontNeed(file *os.File) {
+	_ = unix.Fadvise(int(file.Fd()), 0, 0, unix.FADV_DONTNEED)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package filecollate
+
+import (
+	"os"
+)
+
+// fadvise is Linux-only, so the ReadAhead and DropCacheAfterRead hints are ignored elsewhere.
+func adviseSequential(file *os.File) {}
+
+func adviseDontNeed(file *os.File) {}
@@ -1,69 +1,282 @@
 package filecollate
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log"
+	"math"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/puzpuzpuz/xsync/v3"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 	"golang.org/x/sync/errgroup"
 )
 
 type pair struct {
-	key  string // depends on the KeyGeneratorFunc
-	path string
+	key     string // depends on the KeyGeneratorFunc
+	path    string
+	size    int64
+	modTime time.Time
+	dev     uint64 // zero where unavailable, like ino
+	ino     uint64
+	linked  bool // whether the path is a symlink or below a followed one
 }
 
+// Returned alongside the partial results once the search ran for longer than Cfg.MaxDuration.
+var ErrTimeBudgetExceeded = errors.New("time budget exceeded")
+
+// Returned without searching if Cfg.FastUnsafe is set without Cfg.AcknowledgeCollisionRisk.
+var ErrCollisionRiskUnacknowledged = errors.New("collision risk of FastUnsafe not acknowledged")
+
+// Returned without searching if both Cfg.MarkKeeper and Cfg.ExcludeKeeper are set, since the marked
+// keeper would be left out of the results.
+var ErrKeeperExcluded = errors.New("marked keeper excluded from the results")
+
+// Returned with Cfg.ErrorOnNoMatch if no file passed the filters, along with the num of files and
+// dirs the filters left out.
+var ErrNoFilesMatched = errors.New("no files matched the filters")
+
+// Returned alongside the truncated results once they reached Cfg.MaxResultPaths.
+var ErrResultsTruncated = errors.New("results truncated")
+
+// File found by the walk, waiting to be hashed by a worker.
+type job struct {
+	path   string
+	fi     os.FileInfo
+	linked bool
+}
+
+// Num of jobs buffered per worker, which bounds the memory used by found files waiting to be hashed
+// regardless of the num of files in the tree.
+const jobsPerWorker = 16
+
+// Separates the generated key from the tag of the TagFunc.
+const tagSeparator = "|"
+
 type filecollate struct {
-	g           *errgroup.Group  // "wait group" to limit the num of concurrent search workers
+	ctx         context.Context  // cancels the search once done
+	walkers     *errgroup.Group  // "wait group" of the walks, one per path
+	workers     *errgroup.Group  // "wait group" of the fixed set of workers consuming jobs
+	numWorkers  int              // num of workers to start
+	jobs        chan *job        // bounded channel the walks send found files to
 	pairs       chan *pair       // channel to send pairs to, which are processed and sent to the caller
 	shutdown    chan os.Signal   // channel to receive shutdown signals on
 	generatorFn KeyGeneratorFunc // function that generates a key for a given path to identify files to group
 	filters     Filters          // filters to apply when searching for files to group
+
+	inlineSize int64             // files below this size are hashed inline during the walk
+	keeperless bool              // whether the keeper of each group is excluded from the results
+	markKeeper bool              // whether the keeper is marked, so it must stay among reported members
+	keepStrat  KeepStrategy      // picks the keeper marked with markKeeper
+	baseline   map[string]string // key -> canonical path of known files to match against
+	maxSpread  time.Duration     // max mtime spread of a detailed group's members, 0 for no limit
+	flagSpread bool              // whether groups exceeding maxSpread are flagged instead of dropped
+	maxPerDir  int               // max num of files visited per dir, 0 for no limit
+	failVanish bool              // whether files vanishing before hashing abort the search
+	noMatchErr bool              // whether a walk without files passing the filters fails
+	devices    *deviceLimiter    // limits concurrent reads per device, nil if unlimited
+	devicesErr error             // why the PerDeviceConcurrency is invalid, which fails the search
+	network    *networkBreaker   // retries network errors, nil if they fail the search
+	openSlots  semaphore         // limits the files open for hashing, nil if unlimited
+	global     semaphore         // limits concurrent hashing across searches, nil if unlimited
+	load       *loadLimiter      // limits concurrent hashing by the system load, nil if unlimited
+	hashOpts   HashOptions       // applied to the generators picked by selectFn
+	keyPrefix  string            // prepended to every key
+	buffered   bool              // whether streamed groups are only sent once the search completes
+	ordered    bool              // whether pairs are produced and must be consumed in walk order
+
+	// Symlinks to follow and the real dirs already followed, to not follow loops.
+	followLinks  []string
+	followed     *xsync.MapOf[string, struct{}]
+	includeLinks bool            // whether symlinks to files are reported
+	owned        map[string]bool // absolute paths of dirs never searched, nil if none
+
+	// Already open files hashed instead of opening their path, nil unless hashing open files.
+	openFiles *openFiles
+
+	// Keys reused instead of generating them again.
+	memo  *keyMemo                // memoized keys, nil if disabled
+	known map[FileIdentity]string // keys of files known to be unique from a prior run
+
+	start       time.Time    // when the search started
+	phase       atomic.Int32 // current Phase of the search
+	visited     atomic.Int64 // num of files visited by the walks, before the filters
+	found       atomic.Int64 // num of files passing the filters, queued for hashing unless listed
+	hashed      atomic.Int64 // num of files for which a key was generated
+	dirsSkipped atomic.Int64 // num of dirs skipped by the filters
+
+	// Limit of the paths in groups, once reached the search is stopped and the results truncated.
+	maxPaths    int
+	maxPerGroup int   // members reported per detailed group, 0 for all
+	minReport   int64 // size a group needs a member of to be part of the results
+	resultPaths atomic.Int64
+	truncated   atomic.Bool
+	stop        context.CancelCauseFunc
+
+	// Optional hooks, nil if disabled.
+	tagFn     func(path string) (string, error)                    // tag combined into the key
+	onError   func(path string, err error)                         // receives non-fatal errors
+	onFile    func(path string, fi os.FileInfo)                    // called instead of dispatching valid files
+	onPhase   func(phase Phase, stats Stats)                       // notified on each phase transition
+	onSkipDir func(path string, reason SkipReason, pattern string) // notified of each skipped dir
+	selectFn  func(path string, fi os.FileInfo) KeyGeneratorFunc   // picks the generator per file
 }
 
-func newFilecollate(c Cfg) *filecollate {
-	g := new(errgroup.Group)
-	g.SetLimit(c.Workers)
+func newFilecollate(ctx context.Context, c Cfg) *filecollate {
+	inlineSize := c.InlineHashThreshold
+	if c.deterministic {
+		inlineSize = math.MaxInt64
+	}
+
+	if c.FastUnsafe {
+		c.KeyGenerator, c.SelectKeyGenerator = edgesKeyGenerator, nil
+	}
+
+	devices, devicesErr := newDeviceLimiter(c.PerDeviceConcurrency, c.DefaultDeviceConcurrency)
 
 	return &filecollate{
-		g:           g,
-		pairs:       make(chan *pair, c.Workers),
-		shutdown:    make(chan os.Signal, 1),
-		generatorFn: c.KeyGenerator,
-		filters:     c.Filters,
+		ctx:          ctx,
+		walkers:      new(errgroup.Group),
+		workers:      new(errgroup.Group),
+		numWorkers:   c.Workers,
+		jobs:         make(chan *job, c.Workers*jobsPerWorker),
+		pairs:        make(chan *pair, c.Workers),
+		shutdown:     make(chan os.Signal, 1),
+		generatorFn:  c.HashOptions.apply(c.KeyGenerator),
+		filters:      c.Filters,
+		inlineSize:   inlineSize,
+		keeperless:   c.ExcludeKeeper,
+		devices:      devices,
+		devicesErr:   devicesErr,
+		markKeeper:   c.MarkKeeper,
+		keepStrat:    c.KeepStrategy,
+		baseline:     c.BaselineDB,
+		maxSpread:    c.MaxModTimeSpread,
+		flagSpread:   c.FlagModTimeSpread,
+		start:        time.Now(),
+		memo:         newMemo(c.MemoizeHashes),
+		maxPerDir:    c.MaxFilesPerDir,
+		tagFn:        c.TagFunc,
+		failVanish:   c.FailOnVanishedFiles,
+		noMatchErr:   c.ErrorOnNoMatch,
+		global:       globalSemaphore(),
+		network:      newNetworkBreaker(c.NetworkErrorPolicy),
+		openSlots:    newSemaphore(c.MaxOpenFiles),
+		load:         newLoadLimiter(c.LoadAware, c.TargetLoad, c.Workers),
+		hashOpts:     c.HashOptions,
+		keyPrefix:    c.KeyPrefix,
+		buffered:     c.BufferStream,
+		ordered:      c.deterministic,
+		maxPaths:     c.MaxResultPaths,
+		maxPerGroup:  c.MaxPathsPerGroup,
+		minReport:    c.MinReportSize,
+		followLinks:  absPaths(c.FollowSymlinkPaths),
+		followed:     xsync.NewMapOf[string, struct{}](),
+		includeLinks: c.IncludeSymlinks,
+		owned:        absPathSet(c.OwnedDirs),
+		known:        c.KnownUnique,
+		selectFn:     c.SelectKeyGenerator,
+		onError:      c.OnError,
+		onPhase:      c.OnPhase,
+		onSkipDir:    c.OnSkipDir,
 	}
 }
 
 // Starts the search for files to group which can be customized by the provided Cfg struct.
-func run(c Cfg, consumerFunc func(fc *filecollate)) error {
+//
+// Cancelling the provided context shuts the search down like a signal would, in which case the
+// context's error is returned.
+func run(ctx context.Context, c Cfg, consumerFunc func(fc *filecollate)) error {
+	return runFeed(ctx, c, consumerFunc, (*filecollate).walkPaths)
+}
+
+// Same as run, but the workers are fed by the provided function instead of walking the paths.
+func runFeed(ctx context.Context, c Cfg, consumerFunc func(fc *filecollate), feed func(fc *filecollate, c Cfg) error) error {
 	c.defaults()
-	fc := newFilecollate(c)
 
-	go consumerFunc(fc)
+	if c.FastUnsafe && !c.AcknowledgeCollisionRisk {
+		// Still running the consumer, which then yields empty results.
+		feed = func(*filecollate, Cfg) error { return ErrCollisionRiskUnacknowledged }
+	}
+	if c.MarkKeeper && c.ExcludeKeeper {
+		feed = func(*filecollate, Cfg) error { return ErrKeeperExcluded }
+	}
+
+	if c.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, c.MaxDuration, ErrTimeBudgetExceeded)
+		defer cancel()
+	}
+
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+
+	fc := newFilecollate(ctx, c)
+	fc.stop = stop
+	if fc.devicesErr != nil {
+		feed = func(*filecollate, Cfg) error { return fc.devicesErr }
+	}
+
+	consumed := make(chan struct{})
+	go func() {
+		defer close(consumed)
+		consumerFunc(fc)
+	}()
 	go gracefulShutdown(fc.shutdown)
 
-	for _, path := range c.Paths {
-		p := path
-		fc.g.Go(func() error {
-			return fc.search(p)
-		})
+	var progress sync.WaitGroup
+	searchDone := make(chan struct{})
+	if c.ProgressChan != nil {
+		progress.Add(1)
+		go func() {
+			defer progress.Done()
+			fc.reportProgress(c.ProgressChan, c.ProgressInterval, searchDone)
+		}()
+	}
+
+	for i := 0; i < fc.numWorkers; i++ {
+		fc.workers.Go(fc.work)
+	}
+
+	fc.enterPhase(PhaseWalking)
+	err := feed(fc, c)
+	close(fc.jobs) // Let the workers finish once the remaining jobs are done.
+
+	fc.enterPhase(PhaseHashing)
+	if workErr := fc.workers.Wait(); err == nil {
+		err = workErr
+	}
+	if err == nil && ctx.Err() != nil {
+		err = context.Cause(ctx) // ErrTimeBudgetExceeded if the MaxDuration was exceeded, etc.
 	}
 
-	err := fc.g.Wait()
+	fc.enterPhase(PhaseGrouping)
 	close(fc.pairs) // Trigger pair consumer to process the results.
+	<-consumed
+	if err == nil && fc.truncated.Load() {
+		err = ErrResultsTruncated // Only known once the consumer is done with the remaining pairs
+	}
+
+	close(searchDone)
+	progress.Wait() // Progress channel must be closed once the search returns.
 	return err
 }
 
 // Runs the search and returns a map of keys and paths grouped by the generated key.
 func GetResults(c Cfg) (map[string][]string, error) {
 	collectorChan := make(chan map[string][]string, 1)
-	err := run(c, func(fc *filecollate) {
-		consumePairsMap(fc.pairs, collectorChan)
+	err := run(context.Background(), c, func(fc *filecollate) {
+		fc.consumePairsMap(collectorChan)
 	})
 	return <-collectorChan, err
 }
@@ -71,16 +284,78 @@ func GetResults(c Cfg) (map[string][]string, error) {
 // Runs the search and returns 2D slice of paths, each high-level slice representing a group.
 func GetResultsSlice(c Cfg) ([][]string, error) {
 	collectorChan := make(chan [][]string, 1)
-	err := run(c, func(fc *filecollate) {
-		consumePairsSlice(fc.pairs, collectorChan)
+	err := run(context.Background(), c, func(fc *filecollate) {
+		fc.consumePairsSlice(collectorChan)
 	})
 	return <-collectorChan, err
 }
 
+// Runs the search and returns the groups sorted by key, including details such as the size of
+// each member and the bytes wasted by the group.
+func GetDetailedResults(c Cfg) ([]FileGroup, error) {
+	collectorChan := make(chan []FileGroup, 1)
+	err := run(context.Background(), c, func(fc *filecollate) {
+		fc.consumePairsDetailed(collectorChan)
+	})
+	return <-collectorChan, err
+}
+
+// Runs the search and returns the generated key of every scanned file mapped by its path.
+func collectKeys(c Cfg) (map[string]string, error) {
+	collectorChan := make(chan map[string]string, 1)
+	err := run(context.Background(), c, func(fc *filecollate) {
+		defer close(collectorChan)
+
+		keys := make(map[string]string)
+		for p := range fc.pairs {
+			keys[p.path] = p.key
+		}
+		collectorChan <- keys
+	})
+	return <-collectorChan, err
+}
+
+// Runs the search and streams groups to the provided channel as soon as they're confirmed, which is
+// closed once the search completes.
+//
+// Each value sent is the complete membership of a group so far, always starting with the same path.
+// A group is sent again whenever a new member is found, superseding the previously sent value, unless
+// Cfg.BufferStream is set. With Cfg.ExcludeKeeper, the keeper as of each value is left out like in
+// GetResults, so the first path changes whenever a lexically smaller member is found.
+func StreamResults(ctx context.Context, c Cfg, groupsChan chan<- []string) error {
+	_, err := StreamResultsWithSummary(ctx, c, groupsChan)
+	return err
+}
+
+// Same as StreamResults, but additionally returns the Summary of the search once all groups have
+// been streamed and the channel is closed.
+func StreamResultsWithSummary(ctx context.Context, c Cfg, groupsChan chan<- []string) (Summary, error) {
+	summaryChan := make(chan Summary, 1)
+	err := run(ctx, c, func(fc *filecollate) {
+		summaryChan <- fc.consumePairsStream(groupsChan)
+	})
+	return <-summaryChan, err
+}
+
+// Typed counterpart of StreamResults, which sends each file to the provided channel once its group
+// is confirmed (i.e. the first two members together once the second one is found, and every further
+// member as soon as it's found) with its details and group info. With Cfg.ExcludeKeeper, the keeper
+// as of each file is withheld like in StreamResults, and sent once a lexically smaller member
+// supersedes it. The channel is closed once the search completes or is cancelled.
+func StreamFileResults(ctx context.Context, c Cfg, resultsChan chan<- FileResult) error {
+	done := make(chan struct{})
+	err := run(ctx, c, func(fc *filecollate) {
+		defer close(done)
+		fc.consumePairsFileStream(resultsChan)
+	})
+	<-done
+	return err
+}
+
 // Directly streams produced pairs (key, path) to the provided channel. This is useful if you want to
 // process the key-path pairs yourself.
 func StreamPairs(c Cfg, collectorChan chan *pair) error {
-	return run(c, func(fc *filecollate) {
+	return run(context.Background(), c, func(fc *filecollate) {
 		for p := range fc.pairs {
 			collectorChan <- p
 		}
@@ -89,10 +364,11 @@ func StreamPairs(c Cfg, collectorChan chan *pair) error {
 
 // Processes the produced pairs and sends the results to the provided channel.
 // Depending on the stream bool, results are either sent in chunks or all at once.
-func consumePairsSlice(pairs chan *pair, collector chan [][]string) {
+func (fc *filecollate) consumePairsSlice(collector chan [][]string) {
 	defer close(collector)
 
 	var groupedPaths [][]string
+	var groupedKeys []string // key of each group in groupedPaths
 
 	// key -> index of the slice containing the grouped paths + the first path for the key
 	type data struct {
@@ -101,7 +377,16 @@ func consumePairsSlice(pairs chan *pair, collector chan [][]string) {
 	}
 	m := xsync.NewMapOf[string, data]()
 
-	for p := range pairs {
+	// Canonical paths of the baseline count as the first iteration of their keys.
+	for key, canonical := range fc.baseline {
+		m.Store(key, data{canonical, -1})
+	}
+
+	for p := range fc.reportedPairs() {
+		if fc.isCanonical(p) {
+			continue
+		}
+
 		// -1 is used as a flag to indicate that we have found the first iteration of the key
 		stored, loaded := m.LoadOrStore(p.key, data{p.path, -1})
 		if !loaded {
@@ -112,12 +397,24 @@ func consumePairsSlice(pairs chan *pair, collector chan [][]string) {
 
 		// First match for the key, create a new slice and update the map
 		if idx == -1 {
+			if !fc.admit(1) {
+				continue
+			}
 			groupedPaths = append(groupedPaths, []string{stored.firstPath, p.path})
+			groupedKeys = append(groupedKeys, p.key)
 			m.Store(p.key, data{"", len(groupedPaths) - 1}) // Update idx (first path doesn't matter anymore)
 			continue
 		}
 
-		groupedPaths[idx] = append(groupedPaths[idx], p.path)
+		if fc.admit(len(groupedPaths[idx])) {
+			groupedPaths[idx] = append(groupedPaths[idx], p.path)
+		}
+	}
+
+	if fc.keeperless {
+		for i, paths := range groupedPaths {
+			groupedPaths[i] = fc.withoutKeeper(groupedKeys[i], paths)
+		}
 	}
 
 	collector <- groupedPaths
@@ -125,24 +422,23 @@ func consumePairsSlice(pairs chan *pair, collector chan [][]string) {
 
 // Consumes the pairs and sends the results to the provided channel as a map.
 // Blocks until all pairs have been processed.
-func consumePairsMap(pairs chan *pair, collector chan map[string][]string) {
+func (fc *filecollate) consumePairsMap(collector chan map[string][]string) {
 	defer close(collector)
 
-	m := xsync.NewMapOf[string, []string]()
-
-	for p := range pairs {
-		paths, loaded := m.LoadOrStore(p.key, []string{p.path})
-		if loaded {
-			m.Store(p.key, append(paths, p.path))
-		}
-	}
+	// A single feeder keeps the paths of each group in the order they were found, the map sink is
+	// too cheap to gain from more.
+	sink := newMapSink(fc.admit)
+	fc.feedSink(sink, 1)
 
 	retMap := make(map[string][]string)
-	m.Range(func(key string, paths []string) bool {
+	sink.m.Range(func(key string, paths []string) bool {
 		// If there is only one path for a key, don't include it in the results
 		if len(paths) <= 1 {
 			return true
 		}
+		if fc.keeperless {
+			paths = fc.withoutKeeper(key, paths)
+		}
 		retMap[key] = paths
 		return true
 	})
@@ -150,57 +446,508 @@ func consumePairsMap(pairs chan *pair, collector chan map[string][]string) {
 	collector <- retMap
 }
 
+// Consumes the pairs and sends each group to the provided channel whenever it grows, or only once
+// complete if buffered. Closes the channel and returns the summary once all pairs have been processed.
+func (fc *filecollate) consumePairsStream(groups chan<- []string) Summary {
+	defer close(groups)
+
+	type inode struct{ dev, ino uint64 }
+	m := make(map[string][]string)
+	sizes := make(map[string]int64) // key -> size of a single member
+	copies := make(map[string]int)  // key -> num of members taking up bytes of their own
+	inodes := make(map[inode]bool)  // inodes already counted, each belongs to a single key
+
+	for key, canonical := range fc.baseline {
+		m[key] = []string{canonical}
+		copies[key] = 1
+	}
+
+	for p := range fc.reportedPairs() {
+		if fc.isCanonical(p) {
+			continue
+		}
+
+		if !fc.admit(len(m[p.key])) {
+			continue
+		}
+
+		paths := append(m[p.key], p.path)
+		m[p.key] = paths
+		sizes[p.key] = p.size
+
+		switch id := (inode{p.dev, p.ino}); {
+		case p.linked, id != inode{} && inodes[id]: // Takes up no bytes of its own
+		default:
+			inodes[id] = id != inode{}
+			copies[p.key]++
+		}
+
+		if len(paths) < 2 || fc.buffered {
+			continue
+		}
+
+		fc.sendGroup(groups, fc.streamedGroup(p.key, paths))
+	}
+
+	if fc.buffered {
+		keys := maps.Keys(m)
+		slices.Sort(keys)
+		for _, key := range keys {
+			if paths := m[key]; len(paths) > 1 {
+				fc.sendGroup(groups, fc.streamedGroup(key, paths))
+			}
+		}
+	}
+
+	summary := Summary{FilesScanned: fc.hashed.Load(), DirsSkipped: fc.dirsSkipped.Load(), Truncated: fc.truncated.Load()}
+	for key, paths := range m {
+		if len(paths) < 2 {
+			continue
+		}
+		summary.Groups++
+		summary.Duplicates += len(paths) - 1
+		summary.WastedBytes += int64(max(copies[key]-1, 0)) * sizes[key]
+	}
+
+	return summary
+}
+
+func (fc *filecollate) sendGroup(groups chan<- []string, paths []string) {
+	select {
+	case groups <- paths:
+	case <-fc.ctx.Done(): // Receiver may be gone, keep draining without sending.
+	}
+}
+
+// Admits a path joining a group of the provided num of paths to the results, as long as the total
+// num of paths in groups stays within the MaxResultPaths. Otherwise the search is stopped with the
+// results truncated, and no further paths are admitted.
+func (fc *filecollate) admit(groupLen int) bool {
+	if fc.maxPaths <= 0 || groupLen == 0 {
+		return true // A single path isn't a result yet
+	}
+	if fc.truncated.Load() {
+		return false
+	}
+
+	n := int64(1)
+	if groupLen == 1 {
+		n = 2 // The first path becomes part of the results too
+	}
+
+	if fc.resultPaths.Add(n) > int64(fc.maxPaths) {
+		fc.resultPaths.Add(-n)
+		fc.truncated.Store(true)
+		fc.stop(ErrResultsTruncated)
+		return false
+	}
+	return true
+}
+
+// Returns a copy of the provided key's group of paths to stream, without the keeper if excluded like
+// in the results of GetResults.
+func (fc *filecollate) streamedGroup(key string, paths []string) []string {
+	paths = slices.Clone(paths)
+	if fc.keeperless {
+		paths = fc.withoutKeeper(key, paths)
+	}
+	return paths
+}
+
+// Removes the keeper from the provided key's group of paths.
+func (fc *filecollate) withoutKeeper(key string, paths []string) []string {
+	keeper := fc.keeper(key, paths)
+	return slices.Delete(paths, keeper, keeper+1)
+}
+
+// Returns the index of the keeper in the provided key's group of paths, which is the canonical path
+// if the key matches the baseline, otherwise the lexically smallest path.
+func (fc *filecollate) keeper(key string, paths []string) int {
+	if _, ok := fc.baseline[key]; ok {
+		return 0 // Canonical path is always the first one
+	}
+
+	keeper := 0
+	for i, path := range paths {
+		if path < paths[keeper] {
+			keeper = i
+		}
+	}
+
+	return keeper
+}
+
+// Helper to check if the provided pair is the canonical path of its key in the baseline, which is
+// already part of the results and must not be collected twice.
+func (fc *filecollate) isCanonical(p *pair) bool {
+	canonical, ok := fc.baseline[p.key]
+	return ok && canonical == p.path
+}
+
+// Returns the pairs to collect into the results, which are the produced pairs unless MinReportSize
+// is set. Then the pairs of each group are held back until a member of at least that size is found,
+// and the groups without one are left out entirely, so that the size applies to whole groups even
+// if the key doesn't depend on the size. The order of the pairs is kept otherwise.
+func (fc *filecollate) reportedPairs() <-chan *pair {
+	if fc.minReport <= 0 {
+		return fc.pairs
+	}
+
+	reported := make(chan *pair, cap(fc.pairs))
+	go func() {
+		defer close(reported)
+
+		held := make(map[string][]*pair) // key -> pairs held back, nil once the group is reported
+		for p := range fc.pairs {
+			pending, ok := held[p.key]
+			if !ok || pending != nil {
+				if p.size < fc.minReport {
+					held[p.key] = append(pending, p)
+					continue
+				}
+				for _, h := range pending {
+					reported <- h
+				}
+				held[p.key] = nil
+			}
+			reported <- p
+		}
+	}()
+	return reported
+}
+
 // Produces a pair with the key which is generated by `fc.generatorFn` and the path
 // which is then sent to the pairs channel.
-func (fc *filecollate) producePair(path string) error {
+func (fc *filecollate) producePair(path string, fi os.FileInfo, linked bool) error {
 	if fc.shuttingDown() {
 		return nil // Stop pair production if shutdown is in progress.
 	}
 
-	key, err := fc.generatorFn(path)
+	key, err := fc.fileKey(path, fi)
+	if err != nil || key == "" {
+		return err
+	}
+
+	dev, ino := fileID(fi)
+	fc.hashed.Add(1)
+	fc.pairs <- &pair{key, path, fi.Size(), fi.ModTime(), dev, ino, linked}
+	return nil
+}
+
+// Generates the key of the provided file including its tag, if any. Returns an empty key without
+// an error if the file must be skipped.
+func (fc *filecollate) fileKey(path string, fi os.FileInfo) (string, error) {
+	if fc.known != nil {
+		if key, ok := fc.known[newFileIdentity(path, fi)]; ok {
+			return key, nil // Already includes the prefix and tag of the prior run.
+		}
+	}
+
+	dev, _ := fileID(fi)
+
+	// Slots are released during the backoff of a retry, so that other devices aren't blocked.
+	key, err := fc.network.run(fc.ctx, dev, func() (string, error) {
+		// The load limiter comes first, so that no other slot is held while waiting for the load to drop.
+		releaseLoad := fc.load.acquire()
+		release := fc.devices.acquire(dev)
+		releaseGlobal := fc.global.acquire() // Only after the device, to not hold a slot while waiting
+		releaseOpen := fc.openSlots.acquire()
+		defer releaseLoad()
+		defer release()
+		defer releaseGlobal()
+		defer releaseOpen()
+		return fc.generateKey(path, fi)
+	})
+
 	if err != nil {
 		if errors.Is(err, ErrSkipFile) {
-			return nil // Don't collect ErrSkipFile errors
+			return "", nil // Don't collect ErrSkipFile errors
 		}
-		return err
+		if errors.Is(err, fs.ErrNotExist) && !fc.failVanish {
+			fc.reportError(path, err) // File was deleted after it was found, nothing to group.
+			return "", nil
+		}
+		if errors.Is(err, ErrShortRead) {
+			fc.reportError(path, err) // Key of a partially read file is unreliable.
+			return "", nil
+		}
+		if fc.network != nil && isNetworkError(err) {
+			fc.reportError(path, err) // Retries exhausted, the mount may still recover for other files.
+			return "", nil
+		}
+		if errors.Is(err, ErrMountUnavailable) && fc.stop != nil {
+			fc.stop(err) // Don't keep hammering the dead mount with the remaining files.
+		}
+		return "", err
 	}
 
 	if key == "" {
-		return fmt.Errorf("\nkey generator returned an empty key for path: %s", path)
+		return "", fmt.Errorf("\nkey generator returned an empty key for path: %s", path)
 	}
 
-	fc.pairs <- &pair{key, path}
-	return nil
+	if fc.tagFn != nil {
+		tag, err := fc.tagFn(path)
+		if err != nil {
+			if errors.Is(err, ErrSkipFile) {
+				return "", nil
+			}
+			return "", err
+		}
+		key += tagSeparator + tag // Only files with the same key AND tag are grouped.
+	}
+
+	return fc.keyPrefix + key, nil
+}
+
+// Walks all paths of the provided Cfg concurrently, or one after another if deterministic.
+func (fc *filecollate) walkPaths(c Cfg) error {
+	var err error
+	for _, path := range c.Paths {
+		p := path
+		if c.deterministic {
+			if searchErr := fc.search(p); err == nil {
+				err = searchErr
+			}
+			continue
+		}
+
+		fc.walkers.Go(func() error {
+			return fc.search(p)
+		})
+	}
+
+	if walkErr := fc.walkers.Wait(); err == nil {
+		err = walkErr
+	}
+	if err == nil && fc.noMatchErr && fc.found.Load() == 0 && !fc.shuttingDown() {
+		err = fmt.Errorf("%w: %d files visited, %d dirs skipped", ErrNoFilesMatched, fc.visited.Load(), fc.dirsSkipped.Load())
+	}
+	return err
 }
 
 // Walks the tree of the provided dir and triggers the production of pairs for each valid file.
 func (fc *filecollate) search(dir string) error {
-	return filepath.WalkDir(dir, func(path string, de os.DirEntry, err error) error {
-		if fc.shuttingDown() {
+	return fc.searchAs(dir, dir)
+}
+
+// Walks the tree of the provided real dir with its entries presented below the provided dir, which
+// only differ for the target of a followed symlink.
+func (fc *filecollate) searchAs(dir, real string) error {
+	var perDir dirCounts // only tracked with maxPerDir
+	return filepath.WalkDir(real, func(path string, de os.DirEntry, err error) error {
+		if dir != real {
+			path = dir + strings.TrimPrefix(path, real)
+		}
+
+		// The dir filters only apply below the searched dir, not to the dir itself.
+		if path == dir && err == nil && de.IsDir() {
 			return nil
 		}
 
-		if err != nil {
-			return err
+		if err == nil && de.Type()&fs.ModeSymlink != 0 && fc.followsSymlink(path) {
+			return fc.followSymlink(path)
+		}
+
+		if fc.maxPerDir > 0 && err == nil && de.Type().IsRegular() && !fc.filters.skipFile(path) {
+			parent := filepath.Dir(path)
+			if perDir.add(parent) > fc.maxPerDir {
+				fc.skippedDir(parent, SkipReasonMaxFiles, "")
+				return filepath.SkipDir // Skips the remaining entries of the parent dir
+			}
+		}
+
+		return fc.visit(path, de, err, dir != real)
+	})
+}
+
+// Checks if the provided symlink is matched by one of the FollowSymlinkPaths.
+func (fc *filecollate) followsSymlink(path string) bool {
+	if len(fc.followLinks) == 0 {
+		return false
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs // Only relative below the default "." path
+	}
+
+	for _, pattern := range fc.followLinks {
+		if pattern == filepath.Dir(path) {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
 		}
+	}
+	return false
+}
 
-		if de.IsDir() && fc.filters.skipDir(path) {
+// Searches the target of the provided symlink if it's a dir, unless it was already followed or
+// contains the symlink itself, which would loop forever.
+func (fc *filecollate) followSymlink(link string) error {
+	target, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		fc.reportError(link, err) // Dangling or unreadable symlink
+		return nil
+	}
+
+	fi, err := os.Stat(target)
+	if err == nil && !fi.IsDir() && fc.includeLinks {
+		return fc.visitSymlink(link)
+	}
+	if err != nil || !fi.IsDir() {
+		return nil // Only dirs are followed, a file would be reported as a duplicate of its target.
+	}
+
+	parent, err := filepath.EvalSymlinks(filepath.Dir(link))
+	if err != nil {
+		return nil
+	}
+	if rel, err := filepath.Rel(target, parent); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil // Target is an ancestor of the symlink
+	}
+	if _, loaded := fc.followed.LoadOrStore(target, struct{}{}); loaded {
+		return nil
+	}
+
+	return fc.searchAs(link, target)
+}
+
+// WalkDirFunc of the search, which filters the visited entries and dispatches valid files. Linked
+// is set for entries below a followed symlink.
+func (fc *filecollate) visit(path string, de os.DirEntry, err error, linked bool) error {
+	if fc.shuttingDown() {
+		return filepath.SkipAll // Abort the walk instead of enumerating the rest of the tree.
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if de.IsDir() {
+		if reason, pattern := fc.skipDirReason(path); reason != 0 {
+			fc.skippedDir(path, reason, pattern)
 			return filepath.SkipDir
 		}
+	}
 
-		if de.Type().IsRegular() && !fc.filters.skipFile(path) {
-			fi, err := de.Info()
-			if err != nil || fi.Size() == 0 {
-				return nil
-			}
+	if !de.IsDir() {
+		fc.visited.Add(1)
+	}
+
+	if fc.includeLinks && de.Type()&fs.ModeSymlink != 0 {
+		return fc.visitSymlink(path)
+	}
 
-			fc.g.Go(func() error {
-				return fc.producePair(path)
-			})
+	if de.Type().IsRegular() && !fc.filters.skipFile(path) {
+		fi, err := de.Info()
+		if err != nil || fi.Size() == 0 {
+			return nil
 		}
+		return fc.dispatch(path, fi, linked)
+	}
 
+	return nil
+}
+
+// Returns the reason why the provided dir is skipped, either since it's owned or by the dir
+// filters, along with the matching pattern if any, or 0 if it's searched.
+func (fc *filecollate) skipDirReason(path string) (SkipReason, string) {
+	if fc.owned != nil {
+		if abs, err := filepath.Abs(path); err == nil && fc.owned[abs] {
+			return SkipReasonOwned, ""
+		}
+	}
+	return fc.filters.skipDirReason(path)
+}
+
+// Dispatches the target of the provided symlink like a file found at the symlink's path, if it's
+// a regular file.
+func (fc *filecollate) visitSymlink(path string) error {
+	if fc.filters.skipFile(path) {
 		return nil
-	})
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		fc.reportError(path, err) // Dangling or unreadable symlink
+		return nil
+	}
+	if !fi.Mode().IsRegular() || fi.Size() == 0 {
+		return nil
+	}
+
+	return fc.dispatch(path, fi, true)
+}
+
+// Hashes the provided file found by the walk, either right away or on a worker.
+func (fc *filecollate) dispatch(path string, fi os.FileInfo, linked bool) error {
+	fc.found.Add(1)
+
+	if fc.onFile != nil {
+		fc.onFile(path, fi) // Only listing files, nothing to hash.
+		return nil
+	}
+
+	// Tiny files are cheaper to hash right away than to schedule on a worker.
+	if fi.Size() < fc.inlineSize {
+		return fc.producePair(path, fi, linked)
+	}
+
+	fc.jobs <- &job{path, fi, linked} // Blocks while the workers are busy, which bounds memory usage
+	return nil
+}
+
+// Worker that produces pairs for the jobs until the jobs channel is closed. Errors don't stop the
+// worker, since the walks would block on a full channel otherwise, the first one is returned.
+func (fc *filecollate) work() error {
+	var err error
+	for j := range fc.jobs {
+		if pairErr := fc.producePair(j.path, j.fi, j.linked); err == nil {
+			err = pairErr
+		}
+	}
+	return err
+}
+
+// Helper to count and report a dir that is skipped for the provided reason.
+func (fc *filecollate) skippedDir(path string, reason SkipReason, pattern string) {
+	fc.dirsSkipped.Add(1)
+
+	if fc.onSkipDir != nil {
+		fc.onSkipDir(path, reason, pattern)
+	}
+}
+
+// Num of files counted per dir for the dirs on the path of a walk to the current entry. Since the
+// walk is depth-first, the dirs it left are dropped, which bounds the counts by the depth of the tree.
+type dirCounts []dirCount
+
+type dirCount struct {
+	dir string
+	n   int
+}
+
+// Counts a file of the provided dir and returns the num of files counted for it so far.
+func (c *dirCounts) add(dir string) int {
+	for len(*c) > 0 {
+		top := (*c)[len(*c)-1].dir
+		if top == dir || strings.HasPrefix(dir, strings.TrimSuffix(top, string(filepath.Separator))+string(filepath.Separator)) {
+			break // Still inside the top dir
+		}
+		*c = (*c)[:len(*c)-1]
+	}
+
+	if len(*c) == 0 || (*c)[len(*c)-1].dir != dir {
+		*c = append(*c, dirCount{dir, 0})
+	}
+	(*c)[len(*c)-1].n++
+	return (*c)[len(*c)-1].n
+}
+
+// Helper to report a non-fatal error that caused the provided path to be skipped.
+func (fc *filecollate) reportError(path string, err error) {
+	if fc.onError != nil {
+		fc.onError(path, err)
+	}
 }
 
 // Helper to check if a shutdown signal has been received.
@@ -208,6 +955,8 @@ func (fc *filecollate) shuttingDown() bool {
 	select {
 	case <-fc.shutdown:
 		return true
+	case <-fc.ctx.Done():
+		return true
 	default:
 		return false
 	}
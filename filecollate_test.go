@@ -0,0 +1,1012 @@
+package filecollate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Helper to create a tree of dirs with the given number of small files each, half of them being
+// duplicates of each other.
+func createSmallFilesTree(tb testing.TB, dirs, filesPerDir int) string {
+	tb.Helper()
+	root := tb.TempDir()
+
+	for d := 0; d < dirs; d++ {
+		dir := filepath.Join(root, fmt.Sprintf("dir%d", d))
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			tb.Fatal(err)
+		}
+
+		for f := 0; f < filesPerDir; f++ {
+			content := fmt.Sprintf("file %d", f%(filesPerDir/2+1))
+			path := filepath.Join(dir, fmt.Sprintf("file%d.txt", f))
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+
+	return root
+}
+
+func TestInlineHashThreshold(t *testing.T) {
+	root := createSmallFilesTree(t, 2, 4)
+
+	dispatched, err := GetResults(Cfg{Paths: []string{root}, Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inline, err := GetResults(Cfg{Paths: []string{root}, Workers: 4, InlineHashThreshold: 4 * 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dispatched) == 0 || len(dispatched) != len(inline) {
+		t.Errorf("Expected the same non-empty number of groups, got %d and %d", len(dispatched), len(inline))
+	}
+
+	for key, paths := range dispatched {
+		if len(inline[key]) != len(paths) {
+			t.Errorf("Expected %d paths for key %s, got %d", len(paths), key, len(inline[key]))
+		}
+	}
+}
+
+func BenchmarkSmallFiles(b *testing.B) {
+	root := createSmallFilesTree(b, 20, 100)
+
+	for _, threshold := range []int64{0, 4 * 1024} {
+		b.Run(fmt.Sprintf("threshold=%d", threshold), func(b *testing.B) {
+			cfg := Cfg{Paths: []string{root}, Workers: 4, InlineHashThreshold: threshold}
+			for i := 0; i < b.N; i++ {
+				if _, err := GetResults(cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestExcludeKeeper(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"c.txt", "a.txt", "b.txt"} {
+		os.WriteFile(filepath.Join(root, name), []byte("dupe"), 0o644)
+	}
+
+	groups, err := GetResultsSlice(Cfg{Paths: []string{root}, Workers: 4, ExcludeKeeper: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 1 || len(groups[0]) != 2 {
+		t.Fatalf("Expected a single group with 2 paths, got %v", groups)
+	}
+
+	for _, path := range groups[0] {
+		if path == filepath.Join(root, "a.txt") {
+			t.Errorf("Expected the keeper %s to be excluded, got %v", path, groups[0])
+		}
+	}
+}
+
+func TestExcludeKeeperStreamMembership(t *testing.T) {
+	root := createSmallFilesTree(t, 4, 10)
+
+	sortedGroups := func(groups [][]string) [][]string {
+		for _, group := range groups {
+			slices.Sort(group)
+		}
+		slices.SortFunc(groups, func(a, b []string) int { return strings.Compare(a[0], b[0]) })
+		return groups
+	}
+
+	for _, excludeKeeper := range []bool{false, true} {
+		cfg := Cfg{Paths: []string{root}, Workers: 4, ExcludeKeeper: excludeKeeper}
+
+		results, err := GetResults(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		groupsChan := make(chan []string)
+		latest := make(map[string][]string) // path -> latest streamed membership it's part of
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for group := range groupsChan {
+				for _, path := range group {
+					latest[path] = group
+				}
+			}
+		}()
+
+		if err := StreamResults(context.Background(), cfg, groupsChan); err != nil {
+			t.Fatal(err)
+		}
+		<-done
+
+		var streamed [][]string
+		seen := make(map[string]bool)
+		for _, group := range latest {
+			if !seen[group[0]] {
+				seen[group[0]] = true
+				streamed = append(streamed, group)
+			}
+		}
+
+		expected := sortedGroups(maps.Values(results))
+		if got := sortedGroups(streamed); !reflect.DeepEqual(got, expected) {
+			t.Errorf("ExcludeKeeper %t: expected streamed membership %v, got %v", excludeKeeper, expected, got)
+		}
+	}
+}
+
+func TestBaselineDB(t *testing.T) {
+	root := t.TempDir()
+	copyPath := writeFiles(t, root, [2]string{"copy.txt", "master content"}, [2]string{"unrelated.txt", "unrelated"})[0]
+
+	key, err := Crc32HashKeyGenerator(copyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	canonical := "/library/master.txt"
+	cfg := Cfg{Paths: []string{root}, Workers: 4, BaselineDB: map[string]string{key: canonical}}
+
+	results, err := GetResults(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{canonical, copyPath}
+	if len(results) != 1 || !reflect.DeepEqual(results[key], expected) {
+		t.Errorf("Expected %v for key %s, got %v", expected, key, results)
+	}
+
+	cfg.ExcludeKeeper = true
+	groups, err := GetResultsSlice(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 1 || !reflect.DeepEqual(groups[0], []string{copyPath}) {
+		t.Errorf("Expected the canonical path to be the excluded keeper, got %v", groups)
+	}
+}
+
+func TestSearchAbortsOnShutdown(t *testing.T) {
+	root := createSmallFilesTree(t, 3, 4)
+
+	cfg := Cfg{Paths: []string{root}, Workers: 4}
+	cfg.defaults()
+	fc := newFilecollate(context.Background(), cfg)
+
+	// Shut down on the first hashed file, the rest of the tree must not be walked anymore.
+	hashed := 0
+	fc.inlineSize = 1024
+	fc.generatorFn = func(path string) (string, error) {
+		hashed++
+		close(fc.shutdown)
+		return path, nil
+	}
+
+	go func() {
+		for range fc.pairs {
+		}
+	}()
+	defer close(fc.pairs)
+
+	if err := fc.search(root); err != nil {
+		t.Fatal(err)
+	}
+
+	if hashed != 1 {
+		t.Errorf("Expected a single hashed file, got %d", hashed)
+	}
+
+	if err := fc.visit(filepath.Join(root, "dir2"), nil, nil, false); err != filepath.SkipAll {
+		t.Errorf("Expected filepath.SkipAll once shutting down, got %v", err)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	root := createSmallFilesTree(t, 2, 6)
+	cfg := Cfg{Paths: []string{root}, Workers: 4, deterministic: true}
+
+	first, err := GetResultsSlice(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		filepath.Join(root, "dir0", "file0.txt"),
+		filepath.Join(root, "dir0", "file4.txt"),
+		filepath.Join(root, "dir1", "file0.txt"),
+		filepath.Join(root, "dir1", "file4.txt"),
+	}
+	if len(first) == 0 || !reflect.DeepEqual(first[0], expected) {
+		t.Fatalf("Expected first group to be %v in walk order, got %v", expected, first)
+	}
+
+	for i := 0; i < 5; i++ {
+		groups, err := GetResultsSlice(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(groups, first) {
+			t.Fatalf("Expected identical results across runs, got %v and %v", first, groups)
+		}
+	}
+}
+
+func TestMaxFilesPerDir(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 5; i++ {
+		os.WriteFile(filepath.Join(root, fmt.Sprintf("file%d.txt", i)), []byte("dupe"), 0o644)
+	}
+
+	groups, err := GetResultsSlice(Cfg{Paths: []string{root}, Workers: 4, MaxFilesPerDir: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 1 || len(groups[0]) != 3 {
+		t.Errorf("Expected a single group with 3 paths, got %v", groups)
+	}
+}
+
+func TestMaxFilesPerDirFiltered(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{root, sub} {
+		for i := 0; i < 3; i++ {
+			os.WriteFile(filepath.Join(dir, fmt.Sprintf("a%d.md", i)), []byte("notes"), 0o644)
+			os.WriteFile(filepath.Join(dir, fmt.Sprintf("b%d.txt", i)), []byte("dupe"), 0o644)
+		}
+	}
+
+	var skipped []string
+	groups, err := GetResultsSlice(Cfg{
+		Paths:          []string{root},
+		Filters:        Filters{ExtInclude: []string{".txt"}},
+		MaxFilesPerDir: 3,
+		OnSkipDir: func(path string, reason SkipReason, pattern string) {
+			skipped = append(skipped, path)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The filtered .md files don't count, so all .txt files of both dirs are found.
+	if len(groups) != 1 || len(groups[0]) != 6 || len(skipped) != 0 {
+		t.Errorf("Expected a single group of 6 without skipped dirs, got %v and %v", groups, skipped)
+	}
+}
+
+func TestDirCounts(t *testing.T) {
+	var c dirCounts
+	steps := []struct {
+		dir      string
+		expected int
+	}{
+		{"a", 1},
+		{filepath.Join("a", "b"), 1},
+		{filepath.Join("a", "b"), 2},
+		{"a", 2}, // Back in the parent after the subdir
+		{filepath.Join("a", "c"), 1},
+		{"ab", 1}, // Not a subdir of "a"
+	}
+	for _, step := range steps {
+		if n := c.add(step.dir); n != step.expected {
+			t.Errorf("%s: expected %d, got %d", step.dir, step.expected, n)
+		}
+	}
+	if len(c) != 1 {
+		t.Errorf("Expected only the current dir to be kept, got %v", c)
+	}
+}
+
+func TestTagFunc(t *testing.T) {
+	root := t.TempDir()
+	paths := writeFiles(t, root,
+		[2]string{"a.jpg", "photo"},
+		[2]string{"b.jpg", "photo"},
+		[2]string{"c.jpg", "photo"},
+		[2]string{"d.jpg", "photo"},
+	)
+
+	ratings := map[string]string{paths[0]: "5", paths[1]: "5", paths[2]: "3"}
+	tagFunc := func(path string) (string, error) {
+		rating, ok := ratings[path]
+		if !ok {
+			return "", ErrSkipFile
+		}
+		return rating, nil
+	}
+
+	results, err := GetResults(Cfg{Paths: []string{root}, Workers: 4, TagFunc: tagFunc})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 {
+		t.Fatalf("Expected a single group, got %v", results)
+	}
+
+	for key, group := range results {
+		slices.Sort(group)
+		if !strings.HasSuffix(key, tagSeparator+"5") || !reflect.DeepEqual(group, paths[:2]) {
+			t.Errorf("Expected %v tagged with 5, got %s: %v", paths[:2], key, group)
+		}
+	}
+}
+
+func TestBufferStream(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root,
+		[2]string{"a.txt", "dupe"},
+		[2]string{"b.txt", "dupe"},
+		[2]string{"c.txt", "dupe"},
+		[2]string{"d.txt", "other"},
+		[2]string{"e.txt", "other"},
+	)
+
+	groupsChan := make(chan []string, 16)
+	if err := StreamResults(context.Background(), Cfg{Paths: []string{root}, BufferStream: true}, groupsChan); err != nil {
+		t.Fatal(err)
+	}
+
+	var sizes []int
+	for group := range groupsChan {
+		sizes = append(sizes, len(group))
+	}
+
+	slices.Sort(sizes)
+	if !reflect.DeepEqual(sizes, []int{2, 3}) {
+		t.Errorf("Expected each complete group to be sent once, got groups of sizes %v", sizes)
+	}
+}
+
+func TestOrderedStream(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"one", "two", "two/sub"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFiles(t, root,
+		[2]string{"one/b.txt", "x"},
+		[2]string{"one/a.txt", "y"},
+		[2]string{"one/c.txt", "x"},
+		[2]string{"two/sub/d.txt", "y"},
+		[2]string{"two/a.txt", "x"},
+		[2]string{"two/e.txt", "z"},
+		[2]string{"two/sub/f.txt", "z"},
+	)
+
+	// Groups are sent whenever they grow, in the order the walks of the paths find their files.
+	golden := strings.Join([]string{
+		"one/b.txt one/c.txt",
+		"one/b.txt one/c.txt two/a.txt",
+		"one/a.txt two/sub/d.txt",
+		"two/e.txt two/sub/f.txt",
+	}, "\n")
+
+	cfg := Cfg{Paths: []string{filepath.Join(root, "one"), filepath.Join(root, "two")}, Workers: 8, OrderedStream: true}
+	for i := 0; i < 5; i++ {
+		groupsChan := make(chan []string, 16)
+		if err := StreamResults(context.Background(), cfg, groupsChan); err != nil {
+			t.Fatal(err)
+		}
+
+		var lines []string
+		for group := range groupsChan {
+			for j, path := range group {
+				group[j], _ = filepath.Rel(root, path)
+			}
+			lines = append(lines, strings.Join(group, " "))
+		}
+
+		if got := strings.Join(lines, "\n"); got != golden {
+			t.Fatalf("Expected the stream:\n%s\ngot:\n%s", golden, got)
+		}
+	}
+}
+
+func TestKeyPrefix(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, [2]string{"a.txt", "dupe"}, [2]string{"b.txt", "dupe"})
+
+	results, err := GetResults(Cfg{Paths: []string{root}, KeyPrefix: "vol1:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 {
+		t.Fatalf("Expected a single group, got %v", results)
+	}
+	for key := range results {
+		if !strings.HasPrefix(key, "vol1:") {
+			t.Errorf("Expected key %s to be prefixed with vol1:", key)
+		}
+	}
+}
+
+func TestStreamResultsWithSummary(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root,
+		[2]string{"a.txt", "dupe"},
+		[2]string{"b.txt", "dupe"},
+		[2]string{"c.txt", "dupe"},
+		[2]string{"d.txt", "unique"},
+	)
+
+	groupsChan := make(chan []string)
+	latest := make(map[string][]string) // first path -> latest membership of the group
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for group := range groupsChan {
+			latest[group[0]] = group
+		}
+	}()
+
+	summary, err := StreamResultsWithSummary(context.Background(), Cfg{Paths: []string{root}, Workers: 4}, groupsChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	if len(latest) != 1 {
+		t.Fatalf("Expected a single streamed group, got %v", latest)
+	}
+
+	for _, group := range latest {
+		if len(group) != 3 {
+			t.Errorf("Expected the latest membership to contain 3 paths, got %v", group)
+		}
+	}
+
+	expected := Summary{FilesScanned: 4, Groups: 1, Duplicates: 2, WastedBytes: 8}
+	if summary != expected {
+		t.Errorf("Expected %+v, got %+v", expected, summary)
+	}
+}
+
+func TestStreamResultsCancel(t *testing.T) {
+	root := createSmallFilesTree(t, 2, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Nobody receives from the channel, cancelling must not leave the search blocked.
+	err := StreamResults(ctx, Cfg{Paths: []string{root}, Workers: 4}, make(chan []string))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestVanishedFiles(t *testing.T) {
+	root := t.TempDir()
+	paths := writeFiles(t, root,
+		[2]string{"a.txt", "dupe"},
+		[2]string{"b.txt", "dupe"},
+		[2]string{"vanishing.txt", "dupe"},
+	)
+
+	// Deletes the file between its discovery and hashing.
+	vanishingGenerator := func(path string) (string, error) {
+		if path == paths[2] {
+			os.Remove(path)
+		}
+		return Crc32HashKeyGenerator(path)
+	}
+
+	var reported []string
+	cfg := Cfg{
+		Paths:        []string{root},
+		KeyGenerator: vanishingGenerator,
+		OnError: func(path string, err error) {
+			reported = append(reported, path)
+		},
+		deterministic: true,
+	}
+
+	groups, err := GetResultsSlice(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(groups, [][]string{paths[:2]}) {
+		t.Errorf("Expected %v, got %v", [][]string{paths[:2]}, groups)
+	}
+
+	if !reflect.DeepEqual(reported, paths[2:]) {
+		t.Errorf("Expected %v to be reported, got %v", paths[2:], reported)
+	}
+
+	writeFiles(t, root, [2]string{"vanishing.txt", "dupe"})
+	cfg.FailOnVanishedFiles = true
+
+	if _, err := GetResultsSlice(cfg); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+// Memory usage must be bounded by the jobs channel rather than growing with the num of files, so the
+// peak heap of a search whose results are discarded stays flat across the tree sizes.
+func BenchmarkLargeTree(b *testing.B) {
+	for _, files := range []int{1000, 10000} {
+		b.Run(fmt.Sprintf("%d files", files), func(b *testing.B) {
+			root := createSmallFilesTree(b, files/200, 200)
+			cfg := Cfg{Paths: []string{root}, Workers: 4}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			var peak uint64
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+				stop := sampleHeapInuse(&peak)
+				err := ScanInto(context.Background(), cfg, discardSink{})
+				stop()
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(peak), "peak-heap-bytes")
+		})
+	}
+}
+
+// ResultSink dropping every pair, so that only the memory of the search itself is measured.
+type discardSink struct{}
+
+func (discardSink) AddPair(_, _ string) {}
+func (discardSink) Finalize() error     { return nil }
+
+// Samples the HeapInuse every millisecond and raises the provided peak, until the returned func is
+// called.
+func sampleHeapInuse(peak *uint64) (stop func()) {
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+
+		var stats runtime.MemStats
+		for {
+			runtime.ReadMemStats(&stats)
+			*peak = max(*peak, stats.HeapInuse)
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-sampled
+	}
+}
+
+func TestMaxDuration(t *testing.T) {
+	root := createSmallFilesTree(t, 5, 20)
+
+	_, err := GetResults(Cfg{Paths: []string{root}, Workers: 4, MaxDuration: time.Nanosecond})
+	if !errors.Is(err, ErrTimeBudgetExceeded) {
+		t.Errorf("Expected ErrTimeBudgetExceeded, got %v", err)
+	}
+
+	if _, err := GetResults(Cfg{Paths: []string{root}, Workers: 4, MaxDuration: time.Minute}); err != nil {
+		t.Errorf("Expected no error within the time budget, got %v", err)
+	}
+}
+
+func TestOwnedDirs(t *testing.T) {
+	root := t.TempDir()
+	quarantine := filepath.Join(root, "quarantine")
+	if err := os.Mkdir(quarantine, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, root, [2]string{"a.txt", "dupe"}, [2]string{"b.txt", "other"})
+	writeFiles(t, quarantine, [2]string{"a.txt", "dupe"}, [2]string{"b.txt", "other"})
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(wd, quarantine)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, owned := range []string{quarantine, rel} {
+		var reasons []SkipReason
+		groups, err := GetResultsSlice(Cfg{
+			Paths:     []string{root},
+			OwnedDirs: []string{owned},
+			OnSkipDir: func(path string, reason SkipReason, pattern string) {
+				reasons = append(reasons, reason)
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(groups) != 0 {
+			t.Errorf("%s: expected the quarantined copies to be left out, got %v", owned, groups)
+		}
+		if !slices.Equal(reasons, []SkipReason{SkipReasonOwned}) {
+			t.Errorf("%s: expected the quarantine to be skipped as owned, got %v", owned, reasons)
+		}
+	}
+
+	// Without owning it, the quarantined copies are found again.
+	groups, err := GetResultsSlice(Cfg{Paths: []string{root}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 {
+		t.Errorf("Expected 2 groups, got %v", groups)
+	}
+}
+
+func TestErrorOnNoMatch(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, [2]string{"a.txt", "dupe"}, [2]string{"b.txt", "dupe"}, [2]string{"c.md", "other"})
+
+	c := Cfg{Paths: []string{root}, Filters: Filters{ExtInclude: []string{".jpg"}}, ErrorOnNoMatch: true}
+	_, err := GetResultsSlice(c)
+	if !errors.Is(err, ErrNoFilesMatched) || !strings.Contains(err.Error(), "3 files visited") {
+		t.Errorf("Expected ErrNoFilesMatched with the num of visited files, got %v", err)
+	}
+
+	// Files passing the filters without any duplicates among them are fine.
+	c.ExtInclude = []string{".md"}
+	if _, err := GetResultsSlice(c); err != nil {
+		t.Errorf("Expected no error with a matching file, got %v", err)
+	}
+
+	c.ExtInclude, c.ErrorOnNoMatch = []string{".jpg"}, false
+	if _, err := GetResultsSlice(c); err != nil {
+		t.Errorf("Expected no error by default, got %v", err)
+	}
+}
+
+func TestOnSkipDir(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{".git", "keep", "node_modules"} {
+		os.Mkdir(filepath.Join(root, dir), 0o755)
+		os.WriteFile(filepath.Join(root, dir, "file.txt"), []byte("dupe"), 0o644)
+	}
+	os.WriteFile(filepath.Join(root, "file.txt"), []byte("dupe"), 0o644)
+	os.WriteFile(filepath.Join(root, "file2.txt"), []byte("dupe"), 0o644)
+
+	type skipped struct {
+		path    string
+		reason  SkipReason
+		pattern string
+	}
+	var skips []skipped
+
+	cfg := Cfg{
+		Paths:   []string{root},
+		Filters: Filters{DirsExclude: []string{"node_modules"}},
+		OnSkipDir: func(path string, reason SkipReason, pattern string) {
+			skips = append(skips, skipped{path, reason, pattern})
+		},
+	}
+
+	summary, err := StreamResultsWithSummary(context.Background(), cfg, make(chan []string, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []skipped{
+		{filepath.Join(root, ".git"), SkipReasonHidden, ""},
+		{filepath.Join(root, "node_modules"), SkipReasonExcluded, "node_modules"},
+	}
+	if !reflect.DeepEqual(skips, expected) {
+		t.Errorf("Expected %v, got %v", expected, skips)
+	}
+
+	if summary.DirsSkipped != 2 || summary.Duplicates != 2 {
+		t.Errorf("Expected 2 skipped dirs and 2 duplicates, got %+v", summary)
+	}
+
+	// The searched dir itself must never be skipped, only its subdirs.
+	cfg.SkipSubdirs = true
+	skips = nil
+
+	groups, err := GetResultsSlice(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 1 || len(groups[0]) != 2 || len(skips) != 3 || skips[0].reason != SkipReasonSubdirs {
+		t.Errorf("Expected all 3 subdirs to be skipped and a group of the 2 root files, got %v and %v", skips, groups)
+	}
+}
+
+func TestSelectKeyGenerator(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir,
+		[2]string{"a.txt", "same"},
+		[2]string{"b.txt", "same"},
+		[2]string{"c.log", "differs"},
+		[2]string{"d.log", "from c"},
+	)
+
+	// Files of the same extension are grouped by name, the rest by content.
+	byExt := func(path string) (string, error) { return filepath.Ext(path), nil }
+	cfg := Cfg{
+		Paths: []string{dir},
+		SelectKeyGenerator: func(path string, fi os.FileInfo) KeyGeneratorFunc {
+			if filepath.Ext(fi.Name()) == ".log" {
+				return byExt
+			}
+			return nil
+		},
+	}
+
+	groups, err := GetResultsSlice(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 2 {
+		t.Fatalf("Expected the .txt files grouped by content and the .log files by extension, got %v", groups)
+	}
+}
+
+func TestFollowSymlinkPaths(t *testing.T) {
+	root, ext, ignored := t.TempDir(), t.TempDir(), t.TempDir()
+	a := writeFiles(t, root, [2]string{"a.txt", "dupe"})[0]
+	writeFiles(t, ext, [2]string{"b.txt", "dupe"})
+	writeFiles(t, ignored, [2]string{"c.txt", "dupe"})
+
+	links := map[string]string{"follow": ext, "ignore": ignored, "loop": root}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skip("Symlinks not supported:", err)
+		}
+	}
+
+	groups, err := GetResultsSlice(Cfg{
+		Paths:              []string{root},
+		FollowSymlinkPaths: []string{filepath.Join(root, "follow"), filepath.Join(root, "lo?p")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{a, filepath.Join(root, "follow", "b.txt")}
+	if len(groups) != 1 {
+		t.Fatalf("Expected a single group, got %v", groups)
+	}
+	slices.Sort(groups[0])
+	if !reflect.DeepEqual(groups[0], expected) {
+		t.Errorf("Expected %v, got %v", expected, groups[0])
+	}
+}
+
+func TestFollowSymlinkPathsRelative(t *testing.T) {
+	root, ext := t.TempDir(), t.TempDir()
+	writeFiles(t, root, [2]string{"a.txt", "dupe"})
+	writeFiles(t, ext, [2]string{"b.txt", "dupe"})
+	if err := os.Symlink(ext, filepath.Join(root, "follow")); err != nil {
+		t.Skip("Symlinks not supported:", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(wd, filepath.Join(root, "follow"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := GetResultsSlice(Cfg{Paths: []string{root}, FollowSymlinkPaths: []string{rel}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || len(groups[0]) != 2 {
+		t.Errorf("Expected the relative entry to follow the symlink, got %v", groups)
+	}
+}
+
+func TestFollowSymlinkPathsDotDotDir(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, [2]string{"a.txt", "dupe"})
+	dir := filepath.Join(root, "..b") // Not a parent dir, despite the prefix
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(root, filepath.Join(dir, "loop")); err != nil {
+		t.Skip("Symlinks not supported:", err)
+	}
+
+	groups, err := GetResultsSlice(Cfg{
+		Paths:              []string{root},
+		Filters:            Filters{HiddenInclude: true},
+		FollowSymlinkPaths: []string{filepath.Join(dir, "loop")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 0 {
+		t.Errorf("Expected the loop to the ancestor not to be followed, got %v", groups)
+	}
+}
+
+func TestMaxResultPaths(t *testing.T) {
+	root := createSmallFilesTree(t, 10, 10)
+
+	countPaths := func(groups [][]string) int {
+		n := 0
+		for _, group := range groups {
+			n += len(group)
+		}
+		return n
+	}
+
+	groups, err := GetResultsSlice(Cfg{Paths: []string{root}, MaxResultPaths: 15})
+	if !errors.Is(err, ErrResultsTruncated) {
+		t.Fatalf("Expected ErrResultsTruncated, got %v", err)
+	}
+	if n := countPaths(groups); n == 0 || n > 15 {
+		t.Errorf("Expected at most 15 result paths, got %d", n)
+	}
+
+	results, err := GetResults(Cfg{Paths: []string{root}, MaxResultPaths: 15})
+	if !errors.Is(err, ErrResultsTruncated) || countPaths(maps.Values(results)) > 15 {
+		t.Errorf("Expected at most 15 result paths with ErrResultsTruncated, got %v and %v", results, err)
+	}
+
+	summary, err := StreamResultsWithSummary(context.Background(), Cfg{Paths: []string{root}, MaxResultPaths: 15}, make(chan []string, 100))
+	if !errors.Is(err, ErrResultsTruncated) || !summary.Truncated || summary.Groups+summary.Duplicates > 15 {
+		t.Errorf("Expected a truncated summary of at most 15 paths, got %+v and %v", summary, err)
+	}
+
+	// Not truncated if the limit isn't reached.
+	if _, err := GetDetailedResults(Cfg{Paths: []string{root}, MaxResultPaths: 100}); err != nil {
+		t.Errorf("Expected no error below the limit, got %v", err)
+	}
+}
+
+func TestMinReportSize(t *testing.T) {
+	root := t.TempDir()
+	paths := writeFiles(t, root,
+		[2]string{"a.txt", "small"},
+		[2]string{"b.txt", "small"},
+		[2]string{"c.txt", "much bigger"},
+		[2]string{"d.txt", "much bigger"},
+	)
+
+	var hashed int64
+	progress := make(chan Stats)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for stats := range progress {
+			hashed = max(hashed, stats.FilesHashed)
+		}
+	}()
+
+	groups, err := GetResultsSlice(Cfg{Paths: []string{root}, MinReportSize: 6, ProgressChan: progress})
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 1 {
+		t.Fatalf("Expected only the big group, got %v", groups)
+	}
+	slices.Sort(groups[0])
+	if !reflect.DeepEqual(groups[0], paths[2:]) {
+		t.Errorf("Expected %v, got %v", paths[2:], groups[0])
+	}
+	if hashed != 4 {
+		t.Errorf("Expected all 4 files to be hashed, got %d", hashed)
+	}
+
+	// Whole groups are reported, even with members smaller than the size.
+	root = t.TempDir()
+	paths = writeFiles(t, root,
+		[2]string{"a.bin", "tiny"},
+		[2]string{"b.bin", "much bigger"},
+		[2]string{"c.log", "tiny"},
+		[2]string{"d.log", "small"},
+	)
+	byExt := func(path string) (string, error) { return filepath.Ext(path), nil }
+	c := Cfg{Paths: []string{root}, KeyGenerator: byExt, MinReportSize: 6}
+
+	expected := map[string][]string{".bin": paths[:2]}
+	results, err := GetResults(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, paths := range results {
+		slices.Sort(paths)
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected %v, got %v", expected, results)
+	}
+
+	detailed, err := GetDetailedResults(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(detailed) != 1 || len(detailed[0].Members) != 2 {
+		t.Errorf("Expected only the .bin group with both members, got %v", detailed)
+	}
+
+	groupsChan := make(chan []string)
+	var streamed [][]string
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		for group := range groupsChan {
+			streamed = append(streamed, group)
+		}
+	}()
+	summary, err := StreamResultsWithSummary(context.Background(), c, groupsChan)
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Groups != 1 || len(streamed) != 1 || len(streamed[0]) != 2 {
+		t.Errorf("Expected only the .bin group to be streamed, got %v and %+v", streamed, summary)
+	}
+}
+
+func TestFastUnsafe(t *testing.T) {
+	root := t.TempDir()
+	middle := func(b byte) string {
+		return strings.Repeat("e", edgeSize) + strings.Repeat(string(b), 100) + strings.Repeat("e", edgeSize)
+	}
+	paths := writeFiles(t, root,
+		[2]string{"a.img", middle('a')},
+		[2]string{"b.img", middle('b')}, // Only differs in the middle
+		[2]string{"c.img", "x" + middle('a')[1:]},
+	)
+
+	groups, err := GetResultsSlice(Cfg{Paths: []string{root}, FastUnsafe: true})
+	if !errors.Is(err, ErrCollisionRiskUnacknowledged) || len(groups) != 0 {
+		t.Fatalf("Expected ErrCollisionRiskUnacknowledged without results, got %v and %v", err, groups)
+	}
+
+	groups, err = GetResultsSlice(Cfg{Paths: []string{root}, FastUnsafe: true, AcknowledgeCollisionRisk: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("Expected a single group, got %v", groups)
+	}
+	slices.Sort(groups[0])
+	if !reflect.DeepEqual(groups[0], paths[:2]) {
+		t.Errorf("Expected the files only differing in the middle to collide, got %v", groups[0])
+	}
+}
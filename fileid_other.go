@@ -0,0 +1,12 @@
+//go:build !unix
+
+package filecollate
+
+import (
+	"os"
+)
+
+// Device and inode numbers are unavailable on this platform, so they're always zero.
+func fileID(fi os.FileInfo) (dev, ino uint64) {
+	return 0, 0
+}
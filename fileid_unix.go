@@ -0,0 +1,17 @@
+//go:build unix
+
+package filecollate
+
+import (
+	"os"
+	"syscall"
+)
+
+// Returns the device and inode numbers of the provided file info.
+func fileID(fi os.FileInfo) (dev, ino uint64) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return uint64(st.Dev), uint64(st.Ino)
+}
@@ -25,23 +25,51 @@ func (fl *FiltersList) Set(val string) error {
 	return nil
 }
 
+// Preset of media file extensions, which can be combined as a bitmask, e.g. `Images | Videos`.
+type MediaPreset uint8
+
+const (
+	Images MediaPreset = 1 << iota
+	Videos
+	Audio
+)
+
+var mediaPresetExts = map[MediaPreset][]string{
+	Images: {".jpg", ".jpeg", ".png", ".gif", ".bmp", ".tif", ".tiff", ".webp", ".heic", ".heif", ".avif", ".raw", ".cr2", ".nef", ".arw", ".dng"},
+	Videos: {".mp4", ".m4v", ".mkv", ".mov", ".avi", ".wmv", ".flv", ".webm", ".mpg", ".mpeg", ".3gp", ".ts"},
+	Audio:  {".mp3", ".flac", ".wav", ".aac", ".m4a", ".ogg", ".opus", ".wma", ".aiff", ".alac"},
+}
+
+// Returns the extensions of all presets combined in p.
+func (p MediaPreset) extensions() []string {
+	var exts []string
+	for _, preset := range []MediaPreset{Images, Videos, Audio} {
+		if p&preset != 0 {
+			exts = append(exts, mediaPresetExts[preset]...)
+		}
+	}
+	return exts
+}
+
 type Filters struct {
 	ExtInclude    FiltersList // List of file extensions to include.
 	ExtExclude    FiltersList // List of file extensions to exclude.
 	DirsExclude   FiltersList // List of directories or subdirectories to exclude.
 	SkipSubdirs   bool        // Skip subdirectories.
 	HiddenInclude bool        // Include hidden files and directories.
+	MediaPreset   MediaPreset // Presets of media extensions added to ExtInclude.
 }
 
 // Beauty stringifies the Filters struct.
 func (f *Filters) String() string {
 	return fmt.Sprintf(
-		"\t{\n\t\tSkipSubdirs: %t\n\t\tHiddenInclude: %t\n\t\tExtInclude: %s\n\t\tExtExclude: %s\n\t\tDirsExclude: %s\n\t}",
+		"\t{\n\t\tSkipSubdirs: %t\n\t\tHiddenInclude: %t\n\t\tExtInclude: %s\n\t\tExtExclude: %s\n\t\tDirsExclude: %s\n\t\tMediaPreset: %b\n\t}",
 		f.SkipSubdirs,
 		f.HiddenInclude,
 		f.ExtInclude,
 		f.ExtExclude,
 		f.DirsExclude,
+		f.MediaPreset,
 	)
 }
 
@@ -63,16 +91,61 @@ func (f *Filters) skipFile(path string) bool {
 	return slices.Contains(f.ExtExclude, ext) // Skip files in exclude list
 }
 
+// Reason why a directory was skipped.
+type SkipReason int
+
+const (
+	SkipReasonSubdirs  SkipReason = iota + 1 // Subdirectories are skipped with SkipSubdirs.
+	SkipReasonHidden                         // Hidden directories are skipped without HiddenInclude.
+	SkipReasonExcluded                       // Directory matches a pattern of DirsExclude.
+	SkipReasonMaxFiles                       // Remainder of the directory exceeded Cfg.MaxFilesPerDir.
+	SkipReasonOwned                          // Directory is one of the Cfg.OwnedDirs.
+)
+
+func (r SkipReason) String() string {
+	switch r {
+	case SkipReasonSubdirs:
+		return "subdirs"
+	case SkipReasonHidden:
+		return "hidden"
+	case SkipReasonExcluded:
+		return "excluded"
+	case SkipReasonMaxFiles:
+		return "max files"
+	case SkipReasonOwned:
+		return "owned"
+	default:
+		return "none"
+	}
+}
+
 // Checks if the provided path should be skipped based on dir filters.
 //
 // Assumes that the path is a directory.
 func (f *Filters) skipDir(path string) bool {
+	reason, _ := f.skipDirReason(path)
+	return reason != 0
+}
+
+// Returns the reason why the provided path should be skipped based on dir filters, along with the
+// matching pattern if any, or 0 if it shouldn't be skipped.
+//
+// Assumes that the path is a directory.
+func (f *Filters) skipDirReason(path string) (SkipReason, string) {
 	dirName := filepath.Base(path)
-	if f.SkipSubdirs || skipHidden(dirName, f.HiddenInclude) {
-		return true
+	if f.SkipSubdirs {
+		return SkipReasonSubdirs, ""
+	}
+
+	if skipHidden(dirName, f.HiddenInclude) {
+		return SkipReasonHidden, ""
+	}
+
+	if slices.Contains(f.DirsExclude, dirName) {
+		return SkipReasonExcluded, dirName // Skip dirs in exclude list
 	}
 
-	return slices.Contains(f.DirsExclude, dirName) // Skip dirs in exclude list
+	return 0, ""
 }
 
 // Helper to check if the provided dir or file name is hidden and should be skipped
@@ -86,3 +86,18 @@ func TestSkipDir(t *testing.T) {
 		t.Error("Expected true, got false")
 	}
 }
+
+func TestMediaPresetExtensions(t *testing.T) {
+	if len(Images.extensions()) == 0 || len(Videos.extensions()) == 0 || len(Audio.extensions()) == 0 {
+		t.Error("Expected every preset to have extensions")
+	}
+
+	combined := (Images | Videos).extensions()
+	if len(combined) != len(Images.extensions())+len(Videos.extensions()) {
+		t.Errorf("Expected combined presets to have the extensions of both, got %v", combined)
+	}
+
+	if MediaPreset(0).extensions() != nil {
+		t.Error("Expected no extensions without a preset")
+	}
+}
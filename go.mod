@@ -3,7 +3,9 @@ module github.com/ricci2511/filecollate
 go 1.22.5
 
 require (
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/puzpuzpuz/xsync/v3 v3.3.0
 	golang.org/x/exp v0.0.0-20240613232115-7f521ea00fb8
 	golang.org/x/sync v0.7.0
+	golang.org/x/sys v0.21.0
 )
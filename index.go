@@ -0,0 +1,56 @@
+package filecollate
+
+import (
+	"encoding/json"
+	"io"
+
+	"golang.org/x/exp/slices"
+)
+
+// Content index mapping every key to the paths of all scanned files that share it, including keys
+// with a single path. Built by WriteIndex and read back by LoadIndex.
+type Index map[string][]string
+
+// Returns the paths of the files with the provided key, or nil if there are none in the index.
+func (i Index) Lookup(key string) []string {
+	return i[key]
+}
+
+// Returns the paths of the files in the index which share the key of the provided file, generated
+// with the provided KeyGeneratorFunc (it must be the same one the index was built with).
+func (i Index) LookupFile(path string, generatorFn KeyGeneratorFunc) ([]string, error) {
+	key, err := generatorFn(path)
+	if err != nil {
+		return nil, err
+	}
+	return i.Lookup(key), nil
+}
+
+// Runs the search and writes the complete index of all scanned files as JSON to the provided
+// writer, so that it can later be queried with LoadIndex without scanning again.
+func WriteIndex(c Cfg, w io.Writer) error {
+	keys, err := collectKeys(c)
+	if err != nil {
+		return err
+	}
+
+	index := make(Index)
+	for path, key := range keys {
+		index[key] = append(index[key], path)
+	}
+
+	for _, paths := range index {
+		slices.Sort(paths)
+	}
+
+	return json.NewEncoder(w).Encode(index)
+}
+
+// Reads an index previously written by WriteIndex.
+func LoadIndex(r io.Reader) (Index, error) {
+	var index Index
+	if err := json.NewDecoder(r).Decode(&index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
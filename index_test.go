@@ -0,0 +1,56 @@
+package filecollate
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	root := t.TempDir()
+	paths := writeFiles(t, root,
+		[2]string{"a.txt", "dupe"},
+		[2]string{"b.txt", "dupe"},
+		[2]string{"c.txt", "unique"},
+	)
+
+	var buf bytes.Buffer
+	if err := WriteIndex(Cfg{Paths: []string{root}, Workers: 4}, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := LoadIndex(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(index) != 2 {
+		t.Errorf("Expected 2 keys in the index, got %v", index)
+	}
+
+	// Unique files must be part of the index too.
+	matches, err := index.LookupFile(paths[2], Crc32HashKeyGenerator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(matches, []string{paths[2]}) {
+		t.Errorf("Expected %v, got %v", []string{paths[2]}, matches)
+	}
+
+	other := writeFiles(t, t.TempDir(), [2]string{"new.txt", "dupe"})
+	matches, err = index.LookupFile(other[0], Crc32HashKeyGenerator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{filepath.Join(root, "a.txt"), filepath.Join(root, "b.txt")}
+	if !reflect.DeepEqual(matches, expected) {
+		t.Errorf("Expected %v, got %v", expected, matches)
+	}
+
+	if index.Lookup("missing") != nil {
+		t.Error("Expected nil for a missing key")
+	}
+}
@@ -1,13 +1,21 @@
 package filecollate
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"hash"
 	"hash/crc32"
 	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 // Used to skip a file during key generation.
@@ -16,6 +24,13 @@ import (
 // of filecollate.GetResults() or filecollate.StreamResults().
 var ErrSkipFile = fmt.Errorf("skip file")
 
+// Reported to Cfg.OnError for files that changed size while being hashed with HashOptions.StrictRead,
+// e.g. because they were truncated concurrently, which are skipped instead of getting a bogus key.
+var ErrShortRead = errors.New("short read")
+
+// Num of bytes hashed by the provided partial hash KeyGeneratorFuncs (e.g. Crc32HashKeyGenerator).
+const partialHashSize = 16 * 1024
+
 // KeyGenerator generates a key for a given file path, which then is mapped to
 // a list of file paths that share the same key.
 //
@@ -24,7 +39,133 @@ var ErrSkipFile = fmt.Errorf("skip file")
 // generate a key based on the file name, size, etc.
 type KeyGeneratorFunc func(path string) (string, error)
 
-func generateFileHash(path string, hash hash.Hash, full bool) (string, error) {
+// Options for the content hashing of the provided hash KeyGeneratorFuncs (e.g. Crc32HashKeyGenerator),
+// which are applied when set in the Cfg. Custom KeyGeneratorFuncs are unaffected by them.
+type HashOptions struct {
+	// Ignores a trailing run of null bytes when hashing, so that a file and its zero-padded copy (common
+	// with fixed-block copies) get the same key. This is a heuristic: files where the padding is
+	// intentional match their unpadded counterparts too, and a file of only zeros matches an empty one.
+	TrimTrailingZeros bool
+
+	// Linux-only hints applied with fadvise around the read of each file, ignored elsewhere.
+	// ReadAhead hints a sequential read, which can improve the throughput of large files, while
+	// DropCacheAfterRead drops the read pages from the page cache, so scanning a huge library
+	// doesn't evict data that is actually reused.
+	ReadAhead          bool
+	DropCacheAfterRead bool
+
+	// Compares the num of bytes hashed to the size of the file, which doesn't match if the file was
+	// truncated or grew while being read. Such files are reported to OnError with ErrShortRead and
+	// skipped, since their key is unreliable.
+	StrictRead bool
+
+	// Returns a writer that receives the exact bytes hashed for the file at the provided path
+	// during the same read, e.g. to compute another digest or feed an external indexer without
+	// reading the file twice. It may return nil to not tap a file. It's called from the worker
+	// goroutines, so it must be safe for concurrent use, and a write error fails the file's key
+	// generation.
+	HashTap func(path string) io.Writer `json:"-"`
+}
+
+// Whether none of the options are set.
+func (o HashOptions) isZero() bool {
+	return !o.TrimTrailingZeros && !o.ReadAhead && !o.DropCacheAfterRead && !o.StrictRead && o.HashTap == nil
+}
+
+// Hash and amount of contents the provided hash KeyGeneratorFuncs are made of.
+type hashSpec struct {
+	newHash func() hash.Hash
+	full    bool // whether the entire file contents are hashed or just the first 16KB
+}
+
+func newCrc32() hash.Hash { return crc32.NewIEEE() }
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+func newCrc32c() hash.Hash { return &sizedHash{Hash: crc32.New(castagnoliTable)} }
+
+// Hash whose sum is prefixed with the num of bytes written, so that keys tell files of different
+// sizes apart even if their hashes collide.
+type sizedHash struct {
+	hash.Hash
+	size uint64
+}
+
+func (h *sizedHash) Write(p []byte) (int, error) {
+	h.size += uint64(len(p))
+	return h.Hash.Write(p)
+}
+
+func (h *sizedHash) Sum(b []byte) []byte {
+	return h.Hash.Sum(binary.BigEndian.AppendUint64(b, h.size))
+}
+
+func (h *sizedHash) Reset() {
+	h.size = 0
+	h.Hash.Reset()
+}
+
+func (h *sizedHash) Size() int {
+	return 8 + h.Hash.Size()
+}
+
+// Provided hash KeyGeneratorFuncs mapped by their func pointer, so that the HashOptions can be
+// applied to them.
+var hashSpecs = map[uintptr]hashSpec{
+	funcPointer(Crc32HashKeyGenerator):       {newCrc32, false},
+	funcPointer(FullCrc32HashKeyGenerator):   {newCrc32, true},
+	funcPointer(Sha256HashKeyGenerator):      {sha256.New, false},
+	funcPointer(FullSha256HashKeyGenerator):  {sha256.New, true},
+	funcPointer(CRC32CastagnoliKeyGenerator): {newCrc32c, true},
+}
+
+// Provided KeyGeneratorFuncs by name, see KeyGeneratorByName.
+var keyGenerators = map[string]KeyGeneratorFunc{
+	"crc32":        Crc32HashKeyGenerator,
+	"crc32-full":   FullCrc32HashKeyGenerator,
+	"sha256":       Sha256HashKeyGenerator,
+	"sha256-full":  FullSha256HashKeyGenerator,
+	"crc32c":       CRC32CastagnoliKeyGenerator,
+	"sparse":       SparseAwareHashKeyGenerator,
+	"decompressed": DecompressedHashKeyGenerator,
+	"parent-dir":   ParentDirHashKeyGenerator,
+}
+
+// Returns the provided KeyGeneratorFunc of the provided name (see KeyGeneratorNames), e.g. to pick
+// the generator with a flag.
+func KeyGeneratorByName(name string) (KeyGeneratorFunc, error) {
+	fn, ok := keyGenerators[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown key generator: %s", name)
+	}
+	return fn, nil
+}
+
+// Returns the sorted names of the provided KeyGeneratorFuncs.
+func KeyGeneratorNames() []string {
+	names := maps.Keys(keyGenerators)
+	slices.Sort(names)
+	return names
+}
+
+func funcPointer(fn KeyGeneratorFunc) uintptr {
+	return reflect.ValueOf(fn).Pointer()
+}
+
+// Returns the provided KeyGeneratorFunc with the options applied if it's one of the provided hash
+// KeyGeneratorFuncs, otherwise it's returned as is.
+func (o HashOptions) apply(fn KeyGeneratorFunc) KeyGeneratorFunc {
+	spec, ok := hashSpecs[funcPointer(fn)]
+	if !ok || o.isZero() {
+		return fn
+	}
+
+	return func(path string) (string, error) {
+		return generateFileHash(path, spec.newHash(), spec.full, o)
+	}
+}
+
+func generateFileHash(path string, hash hash.Hash, full bool, opts HashOptions) (string, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return "", err
@@ -32,18 +173,156 @@ func generateFileHash(path string, hash hash.Hash, full bool) (string, error) {
 
 	defer file.Close()
 
+	return hashFile(file, path, hash, full, opts)
+}
+
+// Generates the hash of the provided open file, reading from its current offset.
+func hashFile(file *os.File, path string, hash hash.Hash, full bool, opts HashOptions) (string, error) {
+	if opts.ReadAhead {
+		adviseSequential(file)
+	}
+	if opts.DropCacheAfterRead {
+		defer adviseDontNeed(file)
+	}
+
+	var r io.Reader = file
+	size := int64(-1) // Expected num of bytes, only known if needed
+	if opts.TrimTrailingZeros {
+		end, err := dataEnd(file)
+		if err != nil {
+			return "", err
+		}
+		r = io.NewSectionReader(file, 0, end)
+		size = end
+	}
+
+	var tap io.Writer
+	if opts.HashTap != nil {
+		tap = opts.HashTap(path)
+	}
+
+	if !opts.StrictRead {
+		key, _, err := hashContents(r, hash, full, tap)
+		return key, err
+	}
+
+	if size < 0 {
+		fi, err := file.Stat()
+		if err != nil {
+			return "", err
+		}
+		size = fi.Size()
+	}
+	if !full {
+		size = min(size, partialHashSize)
+	}
+
+	key, n, err := hashContents(r, hash, full, tap)
+	if err == nil && n != size {
+		return "", fmt.Errorf("%w: read %d of %d bytes", ErrShortRead, n, size)
+	}
+	return key, err
+}
+
+// Returns the hash of the contents and the num of bytes it's made of, which are also written to the
+// provided tap if not nil.
+func hashContents(r io.Reader, hash hash.Hash, full bool, tap io.Writer) (string, int64, error) {
+	var w io.Writer = hash
+	if tap != nil {
+		w = io.MultiWriter(hash, tap)
+	}
+
+	var n int64
+	var err error
+
 	// Either copy the entire file contents or just the first 16KB.
 	if full {
-		_, err = io.Copy(hash, file)
+		n, err = io.Copy(w, r)
 	} else {
-		_, err = io.CopyN(hash, file, 1024*16)
+		n, err = io.CopyN(w, r, partialHashSize)
 	}
 
 	if err != nil && err != io.EOF {
+		return "", n, err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), n, nil
+}
+
+// HashBytes returns the key that a file with the provided contents gets with the KeyGenerator,
+// HashOptions and KeyPrefix of the provided Cfg, e.g. to precompute expected keys in tests. The
+// TagFunc and SelectKeyGenerator aren't applied, since they depend on the file.
+//
+// Custom KeyGeneratorFuncs are called with a temporary file containing the contents, so name-based
+// keys are of that file.
+func HashBytes(b []byte, c Cfg) (string, error) {
+	c.defaults()
+
+	spec, ok := hashSpecs[funcPointer(c.KeyGenerator)]
+	if !ok {
+		key, err := generateTempFileKey(b, c.KeyGenerator)
+		if err != nil {
+			return "", err
+		}
+		return c.KeyPrefix + key, nil
+	}
+
+	if c.TrimTrailingZeros {
+		b = bytes.TrimRight(b, "\x00")
+	}
+
+	key, _, err := hashContents(bytes.NewReader(b), spec.newHash(), spec.full, nil)
+	if err != nil {
+		return "", err
+	}
+	return c.KeyPrefix + key, nil
+}
+
+func generateTempFileKey(b []byte, generatorFn KeyGeneratorFunc) (string, error) {
+	file, err := os.CreateTemp("", "filecollate-*")
+	if err != nil {
 		return "", err
 	}
+	defer os.Remove(file.Name())
 
-	return hex.EncodeToString(hash.Sum(nil)), nil
+	_, err = file.Write(b)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return generatorFn(file.Name())
+}
+
+// Returns the offset right after the last non-null byte of the file by reading it backwards,
+// which is the size of the file without its trailing zeros.
+func dataEnd(file *os.File) (int64, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 32*1024)
+	end := fi.Size()
+
+	for end > 0 {
+		n := min(int64(len(buf)), end)
+		if _, err := file.ReadAt(buf[:n], end-n); err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		for i := n - 1; i >= 0; i-- {
+			if buf[i] != 0 {
+				return end - n + i + 1, nil
+			}
+		}
+
+		end -= n
+	}
+
+	return 0, nil
 }
 
 // Crc32HashKeyGenerator is the default if no KeyGenerator is specified.
@@ -52,21 +331,114 @@ func generateFileHash(path string, hash hash.Hash, full bool) (string, error) {
 // which should be enough to achieve a good balance of uniqueness, collision
 // resistance, and performance for most files.
 func Crc32HashKeyGenerator(path string) (string, error) {
-	return generateFileHash(path, crc32.NewIEEE(), false)
+	return generateFileHash(path, crc32.NewIEEE(), false, HashOptions{})
 }
 
 // Generates a crc32 hash of the entire file contents as the key, which
 // is a lot slower than HashKeyGenerator but should be more accurate.
 func FullCrc32HashKeyGenerator(path string) (string, error) {
-	return generateFileHash(path, crc32.NewIEEE(), true)
+	return generateFileHash(path, crc32.NewIEEE(), true, HashOptions{})
 }
 
 // Generates a sha256 hash of the first 16KB of the file contents as the key
 func Sha256HashKeyGenerator(path string) (string, error) {
-	return generateFileHash(path, sha256.New(), false)
+	return generateFileHash(path, sha256.New(), false, HashOptions{})
 }
 
 // Generates a sha256 hash of the entire file contents as the key
 func FullSha256HashKeyGenerator(path string) (string, error) {
-	return generateFileHash(path, sha256.New(), true)
+	return generateFileHash(path, sha256.New(), true, HashOptions{})
+}
+
+// Size of the first and last part of a file hashed by edgesKeyGenerator.
+const edgeSize = 4 * 1024
+
+// Generates a sha256 hash of the file's size and its first and last 4KB as the key, see
+// Cfg.FastUnsafe.
+func edgesKeyGenerator(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	size := fi.Size()
+
+	hash := sha256.New()
+	hash.Write(binary.BigEndian.AppendUint64(nil, uint64(size)))
+
+	buf := make([]byte, edgeSize)
+	for _, off := range []int64{0, max(0, size-edgeSize)} {
+		n, err := file.ReadAt(buf, off)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		hash.Write(buf[:n])
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Generates a hardware-accelerated crc32 (Castagnoli) hash of the entire file contents combined
+// with its size as the key, which is far faster than the sha256 generators. It's a weak key meant
+// for a fast first pass where collisions are acceptable, so it must not be used alone to decide on
+// destructive actions, instead confirm the groups with a content hash (e.g. with VerifyGroups).
+func CRC32CastagnoliKeyGenerator(path string) (string, error) {
+	return generateFileHash(path, newCrc32c(), true, HashOptions{})
+}
+
+// Generates the key of FullSha256HashKeyGenerator prefixed with the name of the file's parent dir
+// as "<dir name>/<hash>", so that only copies in identically named dirs are grouped, e.g. to
+// reconcile versioned copies of a project folder. See ParentDirKeyGenerator.
+func ParentDirHashKeyGenerator(path string) (string, error) {
+	return parentDirKey(path, FullSha256HashKeyGenerator)
+}
+
+// ParentDirKeyGenerator returns a KeyGeneratorFunc that prefixes the key of the provided one with
+// the name of the file's parent dir as "<dir name>/<key>". The HashOptions aren't applied to the
+// provided generator.
+//
+// Only the name of the immediate parent counts, not its location or the dirs above it: in nested
+// structures, "a/src/main.go" and "b/old/src/main.go" are grouped, and copies deeper down, like
+// "a/src/cmd/main.go", are grouped with any other copy in a dir named "cmd", e.g. "c/tools/cmd". To
+// find entire folders copied elsewhere, compare them with CompareDirectories or rank them with
+// TopDuplicateDirs.
+func ParentDirKeyGenerator(fn KeyGeneratorFunc) KeyGeneratorFunc {
+	return func(path string) (string, error) {
+		return parentDirKey(path, fn)
+	}
+}
+
+func parentDirKey(path string, fn KeyGeneratorFunc) (string, error) {
+	key, err := fn(path)
+	if err != nil || key == "" {
+		return key, err
+	}
+
+	abs, err := filepath.Abs(path) // The name of the parent of a relative path may be "."
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(filepath.Dir(abs)) + "/" + key, nil
+}
+
+// XattrKeyGenerator returns a KeyGeneratorFunc that uses the checksum stored in the named extended
+// attribute of the file (e.g. "user.checksum") as the key, which avoids reading the file at all on
+// filesystems or backups that maintain content checksums.
+//
+// Falls back to FullSha256HashKeyGenerator if the attribute is absent, empty or unsupported (always
+// the case on platforms other than Linux and macOS). Files with and without the attribute only end
+// up in the same group if the stored checksum is a hex encoded sha256 of the entire file contents.
+func XattrKeyGenerator(attr string) KeyGeneratorFunc {
+	return func(path string) (string, error) {
+		key, err := getxattr(path, attr)
+		if err != nil || key == "" {
+			return FullSha256HashKeyGenerator(path)
+		}
+		return key, nil
+	}
 }
@@ -1,9 +1,19 @@
 package filecollate
 
 import (
+	"bytes"
+	"crypto/md5"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+
+	"golang.org/x/exp/slices"
 )
 
 // Helper to create a temp file with the given string content and a function to remove it when done.
@@ -118,3 +128,261 @@ func TestSha256HashKeyGeneratorInequality(t *testing.T) {
 		t.Errorf("Expected %s to not equal %s", content1, content2)
 	}
 }
+
+func TestCRC32CastagnoliKeyGenerator(t *testing.T) {
+	content1 := "Go rocks!"
+	content2 := "JavaScript rocks!"
+
+	equal, err := hashKeyGeneratorEquality(content1, CRC32CastagnoliKeyGenerator)
+	if err != nil {
+		t.Error(err)
+	}
+	if !equal {
+		t.Errorf("Expected %s to equal %s", content1, content1)
+	}
+
+	inequal, err := hashKeyGeneratorInequality(content1, content2, CRC32CastagnoliKeyGenerator)
+	if err != nil {
+		t.Error(err)
+	}
+	if !inequal {
+		t.Errorf("Expected %s to not equal %s", content1, content2)
+	}
+
+	// The key starts with the size, so files of different sizes never collide.
+	key, err := HashBytes([]byte(content1), Cfg{KeyGenerator: CRC32CastagnoliKeyGenerator})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%016x", len(content1)); !strings.HasPrefix(key, want) {
+		t.Errorf("Expected key %s to start with the size %s", key, want)
+	}
+}
+
+func TestKeyGeneratorByName(t *testing.T) {
+	for _, name := range KeyGeneratorNames() {
+		fn, err := KeyGeneratorByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fn == nil {
+			t.Errorf("Expected a key generator for %s", name)
+		}
+	}
+
+	fn, err := KeyGeneratorByName("crc32c")
+	if err != nil || funcPointer(fn) != funcPointer(CRC32CastagnoliKeyGenerator) {
+		t.Errorf("Expected crc32c to be CRC32CastagnoliKeyGenerator, got err %v", err)
+	}
+
+	if _, err := KeyGeneratorByName("md5"); err == nil {
+		t.Error("Expected an error for an unknown key generator")
+	}
+}
+
+func TestParentDirHashKeyGenerator(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"v1/assets", "v2/old/assets", "elsewhere"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		writeFiles(t, filepath.Join(root, dir), [2]string{"logo.png", "logo"})
+	}
+
+	groups, err := GetResultsSlice(Cfg{Paths: []string{root}, KeyGenerator: ParentDirHashKeyGenerator})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{filepath.Join(root, "v1/assets/logo.png"), filepath.Join(root, "v2/old/assets/logo.png")}
+	if len(groups) == 1 {
+		slices.Sort(groups[0])
+	}
+	if len(groups) != 1 || !slices.Equal(groups[0], expected) {
+		t.Errorf("Expected only the copies in the assets dirs to be grouped, got %v", groups)
+	}
+
+	key, err := ParentDirHashKeyGenerator(expected[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, _ := FullSha256HashKeyGenerator(expected[0])
+	if key != "assets/"+hash {
+		t.Errorf("Expected key assets/%s, got %s", hash, key)
+	}
+}
+
+func TestTrimTrailingZeros(t *testing.T) {
+	padded, clean := createTempFile("Hello, World!" + strings.Repeat("\x00", 40*1024))
+	defer clean()
+
+	unpadded, clean := createTempFile("Hello, World!")
+	defer clean()
+
+	for _, keyGenFunc := range []KeyGeneratorFunc{Crc32HashKeyGenerator, FullSha256HashKeyGenerator} {
+		key1, _ := keyGenFunc(padded.Name())
+		key2, _ := keyGenFunc(unpadded.Name())
+		if key1 == key2 {
+			t.Error("Expected padded and unpadded files to differ without TrimTrailingZeros")
+		}
+
+		trimmed := HashOptions{TrimTrailingZeros: true}.apply(keyGenFunc)
+
+		key1, err := trimmed(padded.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		key2, err = trimmed(unpadded.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if key1 != key2 {
+			t.Errorf("Expected padded and unpadded files to match with TrimTrailingZeros, got %s and %s", key1, key2)
+		}
+	}
+}
+
+func TestStrictRead(t *testing.T) {
+	file, clean := createTempFile(strings.Repeat("x", 20*1024))
+	defer clean()
+
+	strict := HashOptions{StrictRead: true}
+	for _, keyGenFunc := range []KeyGeneratorFunc{Crc32HashKeyGenerator, FullSha256HashKeyGenerator} {
+		if _, err := strict.apply(keyGenFunc)(file.Name()); err != nil {
+			t.Errorf("Expected a complete read of an unchanged file, got %v", err)
+		}
+	}
+
+	// Files truncated or grown once the read started, from a tap called on every chunk read.
+	const size = 256 * 1024
+	for name, change := range map[string]func(path string) error{
+		"truncated": func(path string) error { return os.Truncate(path, size/2) },
+		"grown": func(path string) error {
+			f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = f.WriteString(strings.Repeat("y", size))
+			return err
+		},
+	} {
+		path := writeFiles(t, t.TempDir(), [2]string{"a.txt", strings.Repeat("x", size)})[0]
+
+		var once sync.Once
+		tap := func(path string) io.Writer {
+			return writerFunc(func(p []byte) (int, error) {
+				var err error
+				once.Do(func() { err = change(path) })
+				return len(p), err
+			})
+		}
+
+		opts := HashOptions{StrictRead: true, HashTap: tap}
+		if _, err := opts.apply(FullCrc32HashKeyGenerator)(path); !errors.Is(err, ErrShortRead) {
+			t.Errorf("Expected ErrShortRead for a %s file, got %v", name, err)
+		}
+	}
+}
+
+// Writer calling the func on every write.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func TestHashTap(t *testing.T) {
+	root := t.TempDir()
+	content := strings.Repeat("tapped", 10*1024)
+	writeFiles(t, root, [2]string{"a.txt", content}, [2]string{"b.txt", content})
+
+	var mu sync.Mutex
+	digests := make(map[string]hash.Hash)
+	tap := func(path string) io.Writer {
+		mu.Lock()
+		defer mu.Unlock()
+		digests[path] = md5.New()
+		return digests[path]
+	}
+
+	cfg := Cfg{Paths: []string{root}, KeyGenerator: FullCrc32HashKeyGenerator, HashOptions: HashOptions{HashTap: tap}}
+	if _, err := GetResults(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := md5.Sum([]byte(content))
+	for path, digest := range digests {
+		if !bytes.Equal(digest.Sum(nil), expected[:]) {
+			t.Errorf("Expected the tap of %s to receive the entire contents", path)
+		}
+	}
+	if len(digests) != 2 {
+		t.Errorf("Expected both files to be tapped, got %d", len(digests))
+	}
+}
+
+func TestHashBytes(t *testing.T) {
+	content := "Hello, World!" + strings.Repeat("x", 20*1024) + "\x00\x00"
+	file, clean := createTempFile(content)
+	defer clean()
+
+	sizeKeyGenerator := func(path string) (string, error) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprint(fi.Size()), nil
+	}
+
+	cfgs := []Cfg{
+		{},
+		{KeyGenerator: FullSha256HashKeyGenerator},
+		{KeyGenerator: FullCrc32HashKeyGenerator, HashOptions: HashOptions{TrimTrailingZeros: true}},
+		{KeyGenerator: sizeKeyGenerator, KeyPrefix: "size:"},
+	}
+
+	for _, c := range cfgs {
+		key, err := HashBytes([]byte(content), c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.defaults()
+		expected, err := c.HashOptions.apply(c.KeyGenerator)(file.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if key != c.KeyPrefix+expected {
+			t.Errorf("Expected %s, got %s", c.KeyPrefix+expected, key)
+		}
+	}
+}
+
+func BenchmarkHashOptions(b *testing.B) {
+	const size = 16 * 1024 * 1024
+	file, clean := createTempFile(strings.Repeat("filecollate", size/11))
+	defer clean()
+
+	benchmarks := []struct {
+		name string
+		opts HashOptions
+	}{
+		{"default", HashOptions{}},
+		{"ReadAhead", HashOptions{ReadAhead: true}},
+		{"DropCacheAfterRead", HashOptions{DropCacheAfterRead: true}},
+	}
+
+	for _, bm := range benchmarks {
+		keyGenFunc := bm.opts.apply(FullCrc32HashKeyGenerator)
+		b.Run(bm.name, func(b *testing.B) {
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				if _, err := keyGenFunc(file.Name()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package filecollate
+
+import "sync"
+
+// Slots shared by all searches of the process, nil if unlimited.
+var globalSlots struct {
+	mu  sync.Mutex
+	sem semaphore
+}
+
+// SetGlobalWorkerLimit limits the num of files hashed at once across all searches of the process,
+// e.g. to not oversubscribe the CPU when a server runs many searches simultaneously, regardless of
+// their Workers. A limit <= 0 removes it. Only searches started afterwards are affected.
+func SetGlobalWorkerLimit(n int) {
+	globalSlots.mu.Lock()
+	defer globalSlots.mu.Unlock()
+
+	globalSlots.sem = newSemaphore(n)
+}
+
+// Returns the global slots for a new search, which keeps them even if the limit changes meanwhile.
+func globalSemaphore() semaphore {
+	globalSlots.mu.Lock()
+	defer globalSlots.mu.Unlock()
+	return globalSlots.sem
+}
+
+// Counting semaphore, nil for no limit.
+type semaphore chan struct{}
+
+// Returns a semaphore with the provided num of slots, nil if n <= 0.
+func newSemaphore(n int) semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return make(semaphore, n)
+}
+
+// Blocks until a slot is free, the returned func must be called to free it again.
+func (s semaphore) acquire() (release func()) {
+	if s == nil {
+		return func() {}
+	}
+
+	s <- struct{}{}
+	return func() { <-s }
+}
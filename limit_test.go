@@ -0,0 +1,44 @@
+package filecollate
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSetGlobalWorkerLimit(t *testing.T) {
+	SetGlobalWorkerLimit(2)
+	t.Cleanup(func() { SetGlobalWorkerLimit(0) })
+
+	var running, peak atomic.Int32
+	slowGenerator := func(path string) (string, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return Crc32HashKeyGenerator(path)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		root := createSmallFilesTree(t, 2, 5)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := GetResults(Cfg{Paths: []string{root}, Workers: 4, KeyGenerator: slowGenerator}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if p := peak.Load(); p > 2 {
+		t.Errorf("Expected at most 2 files hashed at once across searches, got %d", p)
+	}
+}
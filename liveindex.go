@@ -0,0 +1,77 @@
+package filecollate
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/puzpuzpuz/xsync/v3"
+	"golang.org/x/exp/slices"
+)
+
+// Content index which is built up incrementally, checking each added file against everything added
+// before, e.g. to reject downloads which are already on disk. Unlike Index, which is the snapshot
+// of a finished scan, it's safe for concurrent use.
+//
+// Files are hashed with the KeyGenerator (and HashOptions, KeyPrefix and TagFunc) of the Cfg it
+// was created with, the paths and filters of the Cfg don't apply.
+type LiveIndex struct {
+	fc     *filecollate
+	groups *xsync.MapOf[string, []string] // key -> paths in the order they were added
+}
+
+// Returns an empty LiveIndex hashing files according to the provided Cfg.
+func NewLiveIndex(c Cfg) *LiveIndex {
+	c.defaults()
+	return &LiveIndex{newFilecollate(context.Background(), c), xsync.NewMapOf[string, []string]()}
+}
+
+// Hashes the provided file and adds it to the index. Returns the paths added before with the same
+// contents, which is nil if the file is the first of its kind. Empty files and files a search would
+// skip (e.g. with ErrSkipFile) are neither added nor matched. Adding a path again doesn't add it
+// twice, its duplicates are still returned.
+func (i *LiveIndex) Add(path string) ([]string, error) {
+	if i.fc.devicesErr != nil {
+		return nil, i.fc.devicesErr
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("not a regular file: %s", path)
+	}
+	if fi.Size() == 0 {
+		return nil, nil
+	}
+
+	key, err := i.fc.fileKey(path, fi)
+	if err != nil || key == "" {
+		return nil, err
+	}
+
+	var duplicates []string
+	i.groups.Compute(key, func(paths []string, _ bool) ([]string, bool) {
+		duplicates = slices.DeleteFunc(slices.Clone(paths), func(p string) bool { return p == path })
+		if len(duplicates) == len(paths) {
+			paths = append(paths, path) // Not added before
+		}
+		return paths, false
+	})
+
+	if len(duplicates) == 0 {
+		return nil, nil
+	}
+	return duplicates, nil
+}
+
+// Returns a copy of the current contents of the index, e.g. to persist it like WriteIndex does.
+func (i *LiveIndex) Snapshot() Index {
+	index := make(Index, i.groups.Size())
+	i.groups.Range(func(key string, paths []string) bool {
+		index[key] = slices.Clone(paths)
+		return true
+	})
+	return index
+}
@@ -0,0 +1,96 @@
+package filecollate
+
+import (
+	"sync"
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+func TestLiveIndex(t *testing.T) {
+	root := t.TempDir()
+	paths := writeFiles(t, root,
+		[2]string{"a.txt", "dupe"},
+		[2]string{"b.txt", "dupe"},
+		[2]string{"c.txt", "unique"},
+		[2]string{"empty.txt", ""},
+	)
+
+	index := NewLiveIndex(Cfg{KeyGenerator: FullSha256HashKeyGenerator})
+
+	for _, path := range []string{paths[0], paths[2], paths[3]} {
+		dupes, err := index.Add(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dupes != nil {
+			t.Errorf("Expected no duplicates of %s, got %v", path, dupes)
+		}
+	}
+
+	dupes, err := index.Add(paths[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(dupes, paths[:1]) {
+		t.Errorf("Expected %v, got %v", paths[:1], dupes)
+	}
+
+	// Adding a path again matches the others without adding it twice.
+	dupes, err = index.Add(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(dupes, paths[1:2]) {
+		t.Errorf("Expected %v, got %v", paths[1:2], dupes)
+	}
+
+	snapshot := index.Snapshot()
+	if len(snapshot) != 2 {
+		t.Errorf("Expected 2 keys without the empty file, got %v", snapshot)
+	}
+
+	if _, err := index.Add(root); err == nil {
+		t.Error("Expected an error for a dir")
+	}
+}
+
+func TestLiveIndexConcurrentAdd(t *testing.T) {
+	root := t.TempDir()
+	var files [][2]string
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		files = append(files, [2]string{name + ".txt", "dupe"})
+	}
+	paths := writeFiles(t, root, files...)
+
+	index := NewLiveIndex(Cfg{})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firsts int
+	for _, path := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dupes, err := index.Add(path)
+			if err != nil {
+				t.Error(err)
+			}
+			if dupes == nil {
+				mu.Lock()
+				firsts++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Exactly one of the concurrent adds is the first of the group.
+	if firsts != 1 {
+		t.Errorf("Expected a single add without duplicates, got %d", firsts)
+	}
+	for _, group := range index.Snapshot() {
+		if len(group) != len(paths) {
+			t.Errorf("Expected all %d paths in the group, got %v", len(paths), group)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package filecollate
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Interval in which the load average is sampled at most, it only changes every few seconds anyway.
+const loadSampleInterval = time.Second
+
+// Limits the files hashed at once depending on the load of the system, see Cfg.LoadAware.
+type loadLimiter struct {
+	target   float64                 // load above which the limit is halved
+	max      int                     // limit while the system is idle
+	read     func() (float64, error) // reads the current load
+	interval time.Duration
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	limit   int // current limit, always at least 1 so the search keeps making progress
+	active  int // files being hashed
+	sampled time.Time
+}
+
+// Returns nil if disabled or the load can't be read on this platform, which leaves the
+// concurrency unlimited.
+func newLoadLimiter(enabled bool, target float64, workers int) *loadLimiter {
+	if !enabled {
+		return nil
+	}
+	if _, err := loadAverage(); err != nil {
+		return nil
+	}
+
+	if target <= 0 {
+		target = float64(runtime.NumCPU())
+	}
+	l := &loadLimiter{target: target, max: workers, read: loadAverage, interval: loadSampleInterval, limit: workers}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// Blocks until the current limit allows hashing another file, the returned func must be called
+// once it's hashed.
+func (l *loadLimiter) acquire() (release func()) {
+	if l == nil {
+		return func() {}
+	}
+
+	l.mu.Lock()
+	l.adjust()
+	for l.active >= l.limit {
+		l.cond.Wait()
+	}
+	l.active++
+	l.mu.Unlock()
+
+	return func() {
+		l.mu.Lock()
+		l.active--
+		l.adjust()
+		l.mu.Unlock()
+		l.cond.Broadcast()
+	}
+}
+
+// Samples the load if the interval passed, halving the limit while the load exceeds the target and
+// raising it by one again once the load is below 3/4 of the target. The gap keeps the limit from
+// flapping around the target. Must be called with the mutex held.
+func (l *loadLimiter) adjust() {
+	if time.Since(l.sampled) < l.interval {
+		return
+	}
+	l.sampled = time.Now()
+
+	load, err := l.read()
+	if err != nil {
+		return // Keeps the current limit
+	}
+
+	switch {
+	case load > l.target:
+		l.limit = max(1, l.limit/2)
+	case load < l.target*3/4:
+		l.limit = min(l.max, l.limit+1)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build linux
+
+package filecollate
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Returns the 1 minute load average of the system.
+func loadAverage() (float64, error) {
+	b, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+
+	fields := bytes.Fields(b)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected /proc/loadavg: %q", b)
+	}
+	return strconv.ParseFloat(string(fields[0]), 64)
+}
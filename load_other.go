@@ -0,0 +1,10 @@
+//go:build !linux
+
+package filecollate
+
+import "errors"
+
+// The load average is only read from /proc/loadavg, so LoadAware is a no-op elsewhere.
+func loadAverage() (float64, error) {
+	return 0, errors.ErrUnsupported
+}
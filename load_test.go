@@ -0,0 +1,94 @@
+package filecollate
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadLimiter(t *testing.T) {
+	load := 0.0
+	l := &loadLimiter{target: 4, max: 8, read: func() (float64, error) { return load, nil }, limit: 8}
+	l.cond = sync.NewCond(&l.mu)
+
+	tests := []struct {
+		load  float64
+		limit int
+	}{
+		{2, 8},   // Idle, already at the max
+		{5, 4},   // Above the target
+		{9, 2},   // Still above
+		{3.5, 2}, // Below the target, but not below 3/4 of it
+		{2, 3},   // Restored by one
+		{2, 4},
+		{100, 2},
+		{100, 1},
+		{100, 1}, // Never below 1
+	}
+
+	for _, tt := range tests {
+		load = tt.load
+		l.mu.Lock()
+		l.adjust() // Samples every time with a 0 interval
+		l.mu.Unlock()
+		if l.limit != tt.limit {
+			t.Errorf("Load %v: expected limit %d, got %d", tt.load, tt.limit, l.limit)
+		}
+	}
+}
+
+func TestLoadAware(t *testing.T) {
+	root := createSmallFilesTree(t, 4, 10)
+
+	groups, err := GetResultsSlice(Cfg{Paths: []string{root}, Workers: 4, LoadAware: true, TargetLoad: 0.01})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) == 0 {
+		t.Error("Expected groups with a limit of a single file at a time")
+	}
+
+	if runtime.GOOS != "linux" && newLoadLimiter(true, 0, 4) != nil {
+		t.Error("Expected no limiter without /proc/loadavg")
+	}
+}
+
+func TestLoadLimiterAcquiredFirst(t *testing.T) {
+	path := writeFiles(t, t.TempDir(), [2]string{"a.txt", "a"})[0]
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := Cfg{}
+	c.defaults()
+	fc := newFilecollate(context.Background(), c)
+	fc.openSlots = newSemaphore(1)
+
+	// Already at the limit, which doesn't change until the file is hashed.
+	fc.load = &loadLimiter{read: func() (float64, error) { return 0, nil }, interval: time.Hour, sampled: time.Now(), limit: 1, active: 1}
+	fc.load.cond = sync.NewCond(&fc.load.mu)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := fc.fileKey(path, fi)
+		done <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if held := len(fc.openSlots); held != 0 {
+		t.Errorf("Expected no open slot held while waiting for the load, got %d", held)
+	}
+
+	fc.load.mu.Lock()
+	fc.load.active--
+	fc.load.mu.Unlock()
+	fc.load.cond.Broadcast()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
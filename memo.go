@@ -0,0 +1,74 @@
+package filecollate
+
+import (
+	"os"
+
+	"github.com/puzpuzpuz/xsync/v3"
+)
+
+// Max num of keys memoized per search. Once reached, the memo is cleared and starts over.
+const maxMemoEntries = 1 << 16
+
+// Memoized keys of the file identities presented during a search.
+type keyMemo = xsync.MapOf[FileIdentity, string]
+
+// Identifies the content of a file without reading it, as long as the size and mtime of the
+// file at a path are unchanged, its content is assumed to be unchanged too.
+type FileIdentity struct {
+	Path    string
+	Size    int64
+	ModTime int64 // in UnixNano
+}
+
+func newFileIdentity(path string, fi os.FileInfo) FileIdentity {
+	return FileIdentity{path, fi.Size(), fi.ModTime().UnixNano()}
+}
+
+// Generates the key for the provided file, reusing the key of a previous presentation of the same
+// file identity during the search if memoization is enabled.
+func (fc *filecollate) generateKey(path string, fi os.FileInfo) (string, error) {
+	if fc.memo == nil {
+		return fc.generatorFor(path, fi)(path)
+	}
+
+	id := newFileIdentity(path, fi)
+	if key, ok := fc.memo.Load(id); ok {
+		return key, nil
+	}
+
+	key, err := fc.generatorFor(path, fi)(path)
+	if err != nil {
+		return "", err
+	}
+
+	if fc.memo.Size() >= maxMemoEntries {
+		fc.memo.Clear() // Simplest eviction, overlapping roots tend to be scanned close together anyway.
+	}
+	fc.memo.Store(id, key)
+
+	return key, nil
+}
+
+// Returns the generator picked by the SelectKeyGenerator for the provided file, or the configured
+// KeyGenerator if none is picked.
+func (fc *filecollate) generatorFor(path string, fi os.FileInfo) KeyGeneratorFunc {
+	if fc.openFiles != nil {
+		return fc.openFiles.generator(path)
+	}
+
+	if fc.selectFn == nil {
+		return fc.generatorFn
+	}
+
+	if fn := fc.selectFn(path, fi); fn != nil {
+		return fc.hashOpts.apply(fn)
+	}
+	return fc.generatorFn
+}
+
+func newMemo(enabled bool) *keyMemo {
+	if !enabled {
+		return nil
+	}
+	return xsync.NewMapOf[FileIdentity, string]()
+}
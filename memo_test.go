@@ -0,0 +1,34 @@
+package filecollate
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMemoizeHashes(t *testing.T) {
+	root := createSmallFilesTree(t, 2, 4)
+
+	var calls atomic.Int64
+	countingGenerator := func(path string) (string, error) {
+		calls.Add(1)
+		return Crc32HashKeyGenerator(path)
+	}
+
+	// dir0 is presented twice because of the overlapping roots.
+	cfg := Cfg{
+		Paths:         []string{root, filepath.Join(root, "dir0")},
+		Workers:       4,
+		KeyGenerator:  countingGenerator,
+		MemoizeHashes: true,
+		deterministic: true, // Walk the roots sequentially, otherwise both could hash a file at once
+	}
+
+	if _, err := GetResults(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls.Load() != 8 {
+		t.Errorf("Expected 8 keys to be generated, got %d", calls.Load())
+	}
+}
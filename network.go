@@ -0,0 +1,139 @@
+package filecollate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Returned once a device reached the Threshold of its NetworkErrorPolicy, wrapping the last
+// network error, since the search would otherwise keep retrying every file of a dead mount.
+var ErrMountUnavailable = errors.New("mount appears unavailable")
+
+// Policy for files failing with a network error (e.g. a timeout of an NFS or SMB mount), which is
+// retried with a backoff instead of failing the search. Files still failing after all retries are
+// reported to OnError and skipped.
+type NetworkErrorPolicy struct {
+	Retries    int           // Retries of a failing file, 0 skips it right away.
+	Backoff    time.Duration // Wait before the first retry, doubled for each further retry, 1s if 0.
+	MaxBackoff time.Duration // Upper bound of the wait between retries, 30s if 0.
+
+	// Num of consecutive files of a device that still failed after all retries, after which the
+	// search is stopped with ErrMountUnavailable. 0 never stops the search.
+	Threshold int
+}
+
+// Errors of the underlying syscalls that indicate a network filesystem which is slow or gone.
+var networkErrnos = []syscall.Errno{
+	syscall.ETIMEDOUT,
+	syscall.ESTALE,
+	syscall.EHOSTDOWN,
+	syscall.EHOSTUNREACH,
+	syscall.ENETDOWN,
+	syscall.ENETUNREACH,
+	syscall.ECONNRESET,
+	syscall.ECONNABORTED,
+}
+
+// Checks if the provided error is a network error, as opposed to e.g. a permission error which
+// retrying won't fix.
+func isNetworkError(err error) bool {
+	if err == nil || errors.Is(err, ErrMountUnavailable) {
+		return false
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	for _, errno := range networkErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// Retries network errors according to a NetworkErrorPolicy and trips per device once its
+// threshold is reached.
+type networkBreaker struct {
+	policy NetworkErrorPolicy
+
+	mu       sync.Mutex
+	failures map[uint64]int // device -> consecutive files failed with network errors
+}
+
+// Returns nil if no policy is configured, which leaves network errors to fail the search.
+func newNetworkBreaker(policy *NetworkErrorPolicy) *networkBreaker {
+	if policy == nil {
+		return nil
+	}
+
+	b := &networkBreaker{policy: *policy, failures: make(map[uint64]int)}
+	if b.policy.Backoff <= 0 {
+		b.policy.Backoff = time.Second
+	}
+	if b.policy.MaxBackoff <= 0 {
+		b.policy.MaxBackoff = 30 * time.Second
+	}
+	return b
+}
+
+// Calls generate until it doesn't fail with a network error or the retries are exhausted. Once the
+// provided device has tripped, fails right away with ErrMountUnavailable.
+func (b *networkBreaker) run(ctx context.Context, dev uint64, generate func() (string, error)) (string, error) {
+	if b == nil {
+		return generate()
+	}
+
+	if err := b.tripped(dev, nil); err != nil {
+		return "", err
+	}
+
+	key, err := generate()
+	backoff := b.policy.Backoff
+	for i := 0; i < b.policy.Retries && isNetworkError(err); i++ {
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return "", context.Cause(ctx)
+		}
+		backoff = min(2*backoff, b.policy.MaxBackoff)
+		key, err = generate()
+	}
+
+	b.mu.Lock()
+	if isNetworkError(err) {
+		b.failures[dev]++
+	} else {
+		delete(b.failures, dev)
+	}
+	b.mu.Unlock()
+
+	if tripErr := b.tripped(dev, err); tripErr != nil {
+		return "", tripErr
+	}
+	return key, err
+}
+
+// Returns ErrMountUnavailable if the provided device reached the threshold, wrapping the provided
+// error if any.
+func (b *networkBreaker) tripped(dev uint64, err error) error {
+	if b.policy.Threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	failures := b.failures[dev]
+	b.mu.Unlock()
+
+	if failures < b.policy.Threshold {
+		return nil
+	}
+	if err == nil {
+		return fmt.Errorf("%w: %d consecutive files failed", ErrMountUnavailable, failures)
+	}
+	return fmt.Errorf("%w: %d consecutive files failed: %w", ErrMountUnavailable, failures, err)
+}
@@ -0,0 +1,107 @@
+package filecollate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestNetworkErrorPolicy(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root,
+		[2]string{"a.txt", "dupe"},
+		[2]string{"b.txt", "dupe"},
+		[2]string{"flaky.txt", "dupe"},
+		[2]string{"dead.txt", "dupe"},
+	)
+
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	generator := func(path string) (string, error) {
+		mu.Lock()
+		attempts[filepath.Base(path)]++
+		n := attempts[filepath.Base(path)]
+		mu.Unlock()
+
+		switch filepath.Base(path) {
+		case "flaky.txt":
+			if n == 1 {
+				return "", &os.PathError{Op: "read", Path: path, Err: syscall.ETIMEDOUT}
+			}
+		case "dead.txt":
+			return "", &os.PathError{Op: "read", Path: path, Err: syscall.ETIMEDOUT}
+		}
+		return Crc32HashKeyGenerator(path)
+	}
+
+	var reported []string
+	groups, err := GetResultsSlice(Cfg{
+		Paths:              []string{root},
+		KeyGenerator:       generator,
+		NetworkErrorPolicy: &NetworkErrorPolicy{Retries: 2, Backoff: time.Millisecond},
+		OnError: func(path string, err error) {
+			mu.Lock()
+			reported = append(reported, filepath.Base(path))
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 1 || len(groups[0]) != 3 {
+		t.Errorf("Expected a single group with the flaky file, got %v", groups)
+	}
+	if attempts["flaky.txt"] != 2 || attempts["dead.txt"] != 3 {
+		t.Errorf("Expected 2 attempts of the flaky file and 3 of the dead one, got %v", attempts)
+	}
+	if len(reported) != 1 || reported[0] != "dead.txt" {
+		t.Errorf("Expected only the dead file to be reported, got %v", reported)
+	}
+}
+
+func TestNetworkErrorPolicyThreshold(t *testing.T) {
+	root := createSmallFilesTree(t, 2, 10)
+
+	generator := func(path string) (string, error) {
+		return "", &os.PathError{Op: "open", Path: path, Err: syscall.ESTALE}
+	}
+
+	_, err := GetResultsSlice(Cfg{
+		Paths:              []string{root},
+		KeyGenerator:       generator,
+		NetworkErrorPolicy: &NetworkErrorPolicy{Threshold: 3},
+	})
+	if !errors.Is(err, ErrMountUnavailable) || !errors.Is(err, syscall.ESTALE) {
+		t.Errorf("Expected ErrMountUnavailable wrapping the network error, got %v", err)
+	}
+
+	// Without a policy, network errors fail the search like any other error.
+	_, err = GetResultsSlice(Cfg{Paths: []string{root}, KeyGenerator: generator})
+	if !errors.Is(err, syscall.ESTALE) || errors.Is(err, ErrMountUnavailable) {
+		t.Errorf("Expected the network error, got %v", err)
+	}
+}
+
+func TestIsNetworkError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{os.ErrPermission, false},
+		{&os.PathError{Op: "read", Path: "a", Err: syscall.ETIMEDOUT}, true},
+		{os.ErrDeadlineExceeded, true},
+		{ErrMountUnavailable, false},
+	}
+
+	for _, tt := range tests {
+		if got := isNetworkError(tt.err); got != tt.expected {
+			t.Errorf("isNetworkError(%v): expected %t, got %t", tt.err, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package filecollate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Returned by GetResultsFromFiles if the KeyGenerator can't hash an already open file, which is
+// only possible for the provided hash KeyGeneratorFuncs.
+var ErrOpenFileUnsupported = errors.New("key generator can't hash open files")
+
+// Already open file to hash with GetResultsFromFiles, identified by the provided ID in the results
+// in place of a path.
+type OpenFile struct {
+	ID   string
+	File *os.File
+}
+
+// Same as GetResults, but hashes the provided already open files instead of searching paths, e.g.
+// for sandboxed processes which received the files from a parent process but can't open their
+// paths. Since nothing is opened by path, a file can't be swapped between its discovery and its
+// hashing. The results contain the IDs of the files in place of paths.
+//
+// The files are still owned by the caller, which must keep them open until GetResultsFromFiles
+// returns and close them afterwards. Each file is read from the start, leaving its offset
+// wherever the hashing stopped, so files must not be read concurrently elsewhere. Non-regular and
+// empty files are left out.
+//
+// Only the provided hash KeyGeneratorFuncs are supported, otherwise ErrOpenFileUnsupported is
+// returned, as it is with FastUnsafe. The Paths, Filters and SelectKeyGenerator of the provided Cfg
+// are ignored, and the TagFunc is called with the ID of each file instead of a path.
+func GetResultsFromFiles(files []OpenFile, c Cfg) (map[string][]string, error) {
+	c.defaults()
+	if c.FastUnsafe {
+		return nil, fmt.Errorf("%w: FastUnsafe", ErrOpenFileUnsupported)
+	}
+	spec, ok := hashSpecs[funcPointer(c.KeyGenerator)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrOpenFileUnsupported, funcName(c.KeyGenerator))
+	}
+
+	opened := &openFiles{byID: make(map[string]*os.File, len(files)), spec: spec, opts: c.HashOptions}
+	for _, f := range files {
+		if _, ok := opened.byID[f.ID]; ok {
+			return nil, fmt.Errorf("duplicate open file ID: %s", f.ID)
+		}
+		opened.byID[f.ID] = f.File
+	}
+
+	collectorChan := make(chan map[string][]string, 1)
+	err := runFeed(context.Background(), c, func(fc *filecollate) {
+		fc.consumePairsMap(collectorChan)
+	}, func(fc *filecollate, c Cfg) error {
+		fc.openFiles = opened
+		for _, f := range files {
+			if fc.shuttingDown() {
+				return nil
+			}
+
+			fi, err := f.File.Stat()
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.ID, err)
+			}
+			if !fi.Mode().IsRegular() || fi.Size() == 0 {
+				continue
+			}
+
+			fc.found.Add(1)
+			fc.jobs <- &job{f.ID, fi, false}
+		}
+		return nil
+	})
+
+	return <-collectorChan, err
+}
+
+// Open files of GetResultsFromFiles by their ID, hashed like the provided hash KeyGeneratorFunc of
+// the spec would hash their paths.
+type openFiles struct {
+	byID map[string]*os.File
+	spec hashSpec
+	opts HashOptions
+}
+
+// Returns a generator hashing the open file of the provided ID.
+func (o *openFiles) generator(id string) KeyGeneratorFunc {
+	return func(string) (string, error) {
+		file, ok := o.byID[id]
+		if !ok {
+			return "", fmt.Errorf("unknown open file ID: %s", id)
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		return hashFile(file, id, o.spec.newHash(), o.spec.full, o.opts)
+	}
+}
@@ -0,0 +1,81 @@
+package filecollate
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+func TestGetResultsFromFiles(t *testing.T) {
+	root := t.TempDir()
+	paths := writeFiles(t, root,
+		[2]string{"a.txt", "dupe"},
+		[2]string{"b.txt", "dupe"},
+		[2]string{"c.txt", "unique"},
+	)
+
+	var files []OpenFile
+	for i, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		files = append(files, OpenFile{ID: string(rune('x' + i)), File: f})
+	}
+
+	// Paths are never opened, so removing them doesn't matter.
+	if err := os.RemoveAll(root); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := GetResultsFromFiles(files, Cfg{KeyGenerator: FullSha256HashKeyGenerator})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := HashBytes([]byte("dupe"), Cfg{KeyGenerator: FullSha256HashKeyGenerator})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := results[key]
+	slices.Sort(ids)
+	if len(results) != 1 || !reflect.DeepEqual(ids, []string{"x", "y"}) {
+		t.Errorf("Expected only x and y to be grouped, got %v", results)
+	}
+
+	_, err = GetResultsFromFiles(files, Cfg{KeyGenerator: func(string) (string, error) { return "key", nil }})
+	if !errors.Is(err, ErrOpenFileUnsupported) {
+		t.Errorf("Expected ErrOpenFileUnsupported, got %v", err)
+	}
+
+	if _, err := GetResultsFromFiles(append(files, files[0]), Cfg{}); err == nil {
+		t.Error("Expected an error for duplicate IDs")
+	}
+
+	_, err = GetResultsFromFiles(files, Cfg{FastUnsafe: true, AcknowledgeCollisionRisk: true})
+	if !errors.Is(err, ErrOpenFileUnsupported) {
+		t.Errorf("Expected ErrOpenFileUnsupported with FastUnsafe, got %v", err)
+	}
+
+	// The TagFunc receives the IDs, since there are no paths.
+	var mu sync.Mutex
+	var tagged []string
+	tagFunc := func(id string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		tagged = append(tagged, id)
+		return "", nil
+	}
+	if _, err := GetResultsFromFiles(files, Cfg{TagFunc: tagFunc}); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(tagged)
+	if expected := []string{"x", "y", "z"}; !reflect.DeepEqual(tagged, expected) {
+		t.Errorf("Expected the TagFunc to be called with %v, got %v", expected, tagged)
+	}
+}
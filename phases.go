@@ -0,0 +1,170 @@
+package filecollate
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/exp/slices"
+)
+
+// Runs the walk of the provided Cfg's paths and calls fn for every file passing the filters, without
+// generating any keys. fn is called from the concurrent walks, so it must be safe for concurrent use.
+func listFiles(ctx context.Context, c Cfg, fn func(path string, fi os.FileInfo)) error {
+	return runFeed(ctx, c, drainPairs, func(fc *filecollate, c Cfg) error {
+		fc.onFile = fn
+		return fc.walkPaths(c)
+	})
+}
+
+// Consumer that discards all pairs, for runs that don't produce any.
+func drainPairs(fc *filecollate) {
+	for range fc.pairs {
+	}
+}
+
+// First phase of the search exposed on its own: walks the paths of the provided Cfg and returns the
+// files passing the filters grouped by size, without reading any of them. Only sizes shared by at
+// least two files are included, since a file with a unique size can't have a duplicate.
+//
+// The candidates can be inspected or trimmed (e.g. to skip huge files) before being passed to
+// ConfirmGroups.
+func CandidatesBySize(c Cfg) (map[int64][]string, error) {
+	var mu sync.Mutex
+	bySize := make(map[int64][]string)
+
+	err := listFiles(context.Background(), c, func(path string, fi os.FileInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		bySize[fi.Size()] = append(bySize[fi.Size()], path)
+	})
+
+	for size, paths := range bySize {
+		if len(paths) < 2 {
+			delete(bySize, size)
+			continue
+		}
+		slices.Sort(paths)
+	}
+
+	return bySize, err
+}
+
+// Returns the sorted paths of all files passing the filters of the provided Cfg, i.e. the files a
+// search would hash, without reading any of them. Useful to check the filters before an expensive
+// search.
+func ListScanned(c Cfg) ([]string, error) {
+	var mu sync.Mutex
+	var paths []string
+
+	err := listFiles(context.Background(), c, func(path string, fi os.FileInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, path)
+	})
+
+	slices.Sort(paths)
+	return paths, err
+}
+
+// Streaming counterpart of ListScanned for huge trees, which sends the paths to the provided channel
+// in walk order as they're found. The channel is closed once the walk completes or is cancelled.
+func StreamScanned(ctx context.Context, c Cfg, pathsChan chan<- string) error {
+	defer close(pathsChan)
+
+	return listFiles(ctx, c, func(path string, fi os.FileInfo) {
+		select {
+		case pathsChan <- path:
+		case <-ctx.Done(): // Receiver may be gone, the walk is stopped anyway.
+		}
+	})
+}
+
+// Second phase of the search exposed on its own: generates the keys of the provided candidates (as
+// returned by CandidatesBySize) with the configured workers and KeyGenerator, and returns the groups
+// of files sharing both size and key. The Paths and Filters of the provided Cfg are ignored.
+//
+// Paths are sorted within groups, and groups by their first path.
+func ConfirmGroups(candidates map[int64][]string, c Cfg) ([][]string, error) {
+	collectorChan := make(chan [][]string, 1)
+
+	consumer := func(fc *filecollate) {
+		defer close(collectorChan)
+
+		type sizeKey struct {
+			size int64
+			key  string
+		}
+		m := make(map[sizeKey][]string)
+		for p := range fc.pairs {
+			k := sizeKey{p.size, p.key}
+			m[k] = append(m[k], p.path)
+		}
+
+		var groups [][]string
+		for _, paths := range m {
+			if len(paths) > 1 {
+				slices.Sort(paths)
+				groups = append(groups, paths)
+			}
+		}
+
+		slices.SortFunc(groups, func(a, b []string) int {
+			return strings.Compare(a[0], b[0])
+		})
+
+		collectorChan <- groups
+	}
+
+	err := runFeed(context.Background(), c, consumer, func(fc *filecollate, c Cfg) error {
+		for _, paths := range candidates {
+			for _, path := range paths {
+				if fc.shuttingDown() {
+					return nil
+				}
+
+				fi, err := os.Stat(path)
+				if err != nil {
+					if errors.Is(err, fs.ErrNotExist) && !fc.failVanish {
+						fc.reportError(path, err)
+						continue
+					}
+					return err
+				}
+
+				fc.found.Add(1)
+				fc.jobs <- &job{path, fi, false}
+			}
+		}
+		return nil
+	})
+
+	return <-collectorChan, err
+}
+
+// Upper bound of the duplicates of a search, as returned by QuickDuplicateEstimate.
+type Estimate struct {
+	Files               int   // Files sharing their size with at least one other file.
+	Sizes               int   // Distinct sizes shared by at least two files.
+	Bytes               int64 // Bytes taken up by those files.
+	MaxReclaimableBytes int64 // Bytes freed if all files of the same size were duplicates, all but one per size.
+}
+
+// Estimates the duplicates of the provided Cfg by grouping the files by size only (see
+// CandidatesBySize), without reading any of them. It's an instant upper bound of the potential of a
+// dedup, e.g. to decide whether a full search is worthwhile.
+func QuickDuplicateEstimate(c Cfg) (Estimate, error) {
+	candidates, err := CandidatesBySize(c)
+
+	est := Estimate{Sizes: len(candidates)}
+	for size, paths := range candidates {
+		est.Files += len(paths)
+		est.Bytes += int64(len(paths)) * size
+		est.MaxReclaimableBytes += int64(len(paths)-1) * size
+	}
+
+	return est, err
+}
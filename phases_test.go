@@ -0,0 +1,111 @@
+package filecollate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+func TestCandidatesAndConfirmGroups(t *testing.T) {
+	root := t.TempDir()
+	paths := writeFiles(t, root,
+		[2]string{"a.txt", "same"},
+		[2]string{"b.txt", "same"},
+		[2]string{"c.txt", "diff"}, // Same size as a and b, but different content
+		[2]string{"d.txt", "unique size"},
+	)
+
+	cfg := Cfg{Paths: []string{root}, Workers: 4}
+
+	candidates, err := CandidatesBySize(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[int64][]string{4: paths[:3]}
+	if !reflect.DeepEqual(candidates, expected) {
+		t.Fatalf("Expected %v, got %v", expected, candidates)
+	}
+
+	groups, err := ConfirmGroups(candidates, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(groups, [][]string{paths[:2]}) {
+		t.Errorf("Expected %v, got %v", [][]string{paths[:2]}, groups)
+	}
+}
+
+func TestQuickDuplicateEstimate(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root,
+		[2]string{"a.txt", "same"},
+		[2]string{"b.txt", "same"},
+		[2]string{"c.txt", "diff"},
+		[2]string{"d.txt", "pair 1"},
+		[2]string{"e.txt", "pair 2"},
+		[2]string{"f.txt", "unique size"},
+	)
+
+	est, err := QuickDuplicateEstimate(Cfg{Paths: []string{root}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Estimate{Files: 5, Sizes: 2, Bytes: 3*4 + 2*6, MaxReclaimableBytes: 2*4 + 6}
+	if est != expected {
+		t.Errorf("Expected %+v, got %+v", expected, est)
+	}
+}
+
+func TestListScanned(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "skipped"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	paths := writeFiles(t, root,
+		[2]string{"a.txt", "a"},
+		[2]string{"b.txt", "b"},
+		[2]string{"c.log", "c"},         // Excluded extension
+		[2]string{"empty.txt", ""},      // Empty files are never hashed
+		[2]string{".hidden.txt", "d"},   // Hidden
+		[2]string{"skipped/e.txt", "e"}, // Excluded dir
+	)
+
+	cfg := Cfg{
+		Paths:   []string{root},
+		Filters: Filters{ExtInclude: FiltersList{".txt"}, DirsExclude: FiltersList{"skipped"}},
+	}
+
+	scanned, err := ListScanned(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(scanned, paths[:2]) {
+		t.Errorf("Expected %v, got %v", paths[:2], scanned)
+	}
+
+	pathsChan := make(chan string)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StreamScanned(context.Background(), cfg, pathsChan)
+	}()
+
+	var streamed []string
+	for path := range pathsChan {
+		streamed = append(streamed, path)
+	}
+	if err := <-errChan; err != nil {
+		t.Fatal(err)
+	}
+
+	slices.Sort(streamed)
+	if !reflect.DeepEqual(streamed, paths[:2]) {
+		t.Errorf("Expected %v to be streamed, got %v", paths[:2], streamed)
+	}
+}
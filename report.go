@@ -0,0 +1,166 @@
+package filecollate
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Group as written by WriteResultsNDJSON, one per line.
+type groupRecord struct {
+	Key     string   `json:"key"`
+	Size    int64    `json:"size"`
+	Paths   []string `json:"paths"`
+	Omitted int      `json:"omitted,omitempty"` // Num of paths left out by Cfg.MaxPathsPerGroup
+	Keeper  string   `json:"keeper,omitempty"`  // Only set with Cfg.MarkKeeper
+}
+
+func newGroupRecord(g FileGroup, c Cfg) groupRecord {
+	return groupRecord{g.Key, g.GroupSize, g.Paths(), len(g.Omitted), markedKeeper(g, c)}
+}
+
+// Returns the path of the keeper of the provided group if the Cfg marks keepers, empty otherwise.
+func markedKeeper(g FileGroup, c Cfg) string {
+	if !c.MarkKeeper || len(g.AllMembers()) == 0 {
+		return ""
+	}
+	return groupKeeper(g, c.KeepStrategy).Path
+}
+
+// Runs the search and writes each group as a JSON object ({"key", "size", "paths"}, plus "keeper"
+// with Cfg.MarkKeeper) per line to the provided writer.
+//
+// Groups are sorted by key and their paths lexically, so the same results always produce the same
+// output, e.g. to diff the reports of two runs.
+func WriteResultsNDJSON(c Cfg, w io.Writer) error {
+	groups, err := sortedGroups(c)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for _, g := range groups {
+		if err := enc.Encode(newGroupRecord(g, c)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Runs the search and writes the groups as NDJSON (see WriteResultsNDJSON) to the provided num of
+// shards, e.g. to post-process huge results in parallel. Each group is routed to the shard of the
+// FNV-1a hash of its key modulo shards, so the assignment is stable across runs.
+//
+// The provided open func is called once for every shard, even the empty ones, and writers that
+// implement io.Closer are closed once their shard is written.
+func WriteResultsSharded(c Cfg, shards int, open func(shard int) (io.Writer, error)) error {
+	if shards <= 0 {
+		return fmt.Errorf("invalid num of shards: %d", shards)
+	}
+
+	groups, err := sortedGroups(c)
+	if err != nil {
+		return err
+	}
+
+	sharded := make([][]FileGroup, shards)
+	for _, g := range groups {
+		shard := shardOf(g.Key, shards)
+		sharded[shard] = append(sharded[shard], g)
+	}
+
+	for shard, groups := range sharded {
+		if err := writeShard(shard, groups, c, open); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func shardOf(key string, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(shards))
+}
+
+func writeShard(shard int, groups []FileGroup, c Cfg, open func(shard int) (io.Writer, error)) error {
+	w, err := open(shard)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for _, g := range groups {
+		if err = enc.Encode(newGroupRecord(g, c)); err != nil {
+			break
+		}
+	}
+
+	if closer, ok := w.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Runs the search and writes a CSV with a "key,size,path" row per member of each group to the
+// provided writer, with an additional "keeper" column (true or false) if Cfg.MarkKeeper is set.
+// Sorted like WriteResultsNDJSON.
+func WriteResultsCSV(c Cfg, w io.Writer) error {
+	groups, err := sortedGroups(c)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	header := []string{"key", "size", "path"}
+	if c.MarkKeeper {
+		header = append(header, "keeper")
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		size := strconv.FormatInt(g.GroupSize, 10)
+		keeper := markedKeeper(g, c)
+		for _, m := range g.Members {
+			row := []string{g.Key, size, m.Path}
+			if c.MarkKeeper {
+				row = append(row, strconv.FormatBool(m.Path == keeper))
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// Returns the detailed results sorted by key with the members of each group sorted by path, since
+// the order in which members are found depends on the scheduling of the walks and workers.
+func sortedGroups(c Cfg) ([]FileGroup, error) {
+	groups, err := GetDetailedResults(c) // Already sorted by key
+	if err != nil {
+		return nil, err
+	}
+
+	for _, g := range groups {
+		slices.SortFunc(g.Members, func(a, b FileGroupMember) int {
+			return strings.Compare(a.Path, b.Path)
+		})
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,203 @@
+package filecollate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteResultsDeterministic(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a", "b", "c"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		writeFiles(t, filepath.Join(root, dir),
+			[2]string{"1.txt", "one"},
+			[2]string{"2.txt", "two"},
+			[2]string{"3.txt", "three " + dir},
+		)
+	}
+
+	writers := map[string]func(Cfg, *bytes.Buffer) error{
+		"ndjson": func(c Cfg, b *bytes.Buffer) error { return WriteResultsNDJSON(c, b) },
+		"csv":    func(c Cfg, b *bytes.Buffer) error { return WriteResultsCSV(c, b) },
+	}
+
+	for name, write := range writers {
+		var first, second bytes.Buffer
+		if err := write(Cfg{Paths: []string{root}, Workers: 4}, &first); err != nil {
+			t.Fatal(err)
+		}
+		if err := write(Cfg{Paths: []string{root}, Workers: 4}, &second); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(first.Bytes(), second.Bytes()) {
+			t.Errorf("%s: expected byte-identical output, got:\n%s\nand:\n%s", name, first.String(), second.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := WriteResultsCSV(Cfg{Paths: []string{root}}, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	// Header and a row per member of the 2 groups of 3.
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 7 || lines[0] != "key,size,path" {
+		t.Errorf("Unexpected CSV output:\n%s", out.String())
+	}
+}
+
+func TestWriteResultsMarkKeeper(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "a", "deep"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	paths := writeFiles(t, root,
+		[2]string{"a/deep/1.txt", "dupe"},
+		[2]string{"b.txt", "dupe"},
+		[2]string{"c.txt", "dupe"},
+	)
+	c := Cfg{Paths: []string{root}, MarkKeeper: true, KeepStrategy: KeepShallowest}
+	keeper := paths[1] // Shallowest, and lexically first among the shallowest
+
+	var out bytes.Buffer
+	if err := WriteResultsNDJSON(c, &out); err != nil {
+		t.Fatal(err)
+	}
+	var record groupRecord
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Keeper != keeper {
+		t.Errorf("Expected NDJSON keeper %s, got %s", keeper, record.Keeper)
+	}
+
+	out.Reset()
+	if err := WriteResultsCSV(c, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if lines[0] != "key,size,path,keeper" {
+		t.Errorf("Expected a keeper column, got header %s", lines[0])
+	}
+	var kept []string
+	for _, line := range lines[1:] {
+		fields := strings.Split(line, ",")
+		if fields[3] == "true" {
+			kept = append(kept, fields[2])
+		}
+	}
+	if len(kept) != 1 || kept[0] != keeper {
+		t.Errorf("Expected CSV keeper %s, got %v", keeper, kept)
+	}
+
+	out.Reset()
+	if err := WriteResultsDot(c, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), dotQuote(filepath.Dir(keeper))+" [style=bold];") {
+		t.Errorf("Expected the dir of the keeper to be bold, got:\n%s", out.String())
+	}
+
+	// Unmarked by default.
+	out.Reset()
+	if err := WriteResultsNDJSON(Cfg{Paths: []string{root}}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), `"keeper"`) {
+		t.Errorf("Expected no keeper without MarkKeeper, got %s", out.String())
+	}
+}
+
+func TestWriteResultsMarkKeeperReported(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a", "b"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paths := writeFiles(t, root,
+		[2]string{"a/1.txt", "dupe"},
+		[2]string{"b/2.txt", "dupe"},
+		[2]string{"c.txt", "dupe"}, // Shallowest, but sorted last
+	)
+	c := Cfg{Paths: []string{root}, MarkKeeper: true, KeepStrategy: KeepShallowest, MaxPathsPerGroup: 2}
+
+	var out bytes.Buffer
+	if err := WriteResultsNDJSON(c, &out); err != nil {
+		t.Fatal(err)
+	}
+	var record groupRecord
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{paths[0], paths[2]}; record.Keeper != paths[2] || !reflect.DeepEqual(record.Paths, expected) {
+		t.Errorf("Expected keeper %s among the paths %v, got %+v", paths[2], expected, record)
+	}
+	if record.Omitted != 1 {
+		t.Errorf("Expected 1 omitted path, got %d", record.Omitted)
+	}
+
+	// The keeper can't be marked if it's excluded.
+	c.ExcludeKeeper = true
+	if err := WriteResultsNDJSON(c, &out); !errors.Is(err, ErrKeeperExcluded) {
+		t.Errorf("Expected ErrKeeperExcluded, got %v", err)
+	}
+}
+
+func TestWriteResultsSharded(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 20; i++ {
+		content := strings.Repeat("x", i+1)
+		writeFiles(t, root, [2]string{fmt.Sprintf("%d-a.txt", i), content}, [2]string{fmt.Sprintf("%d-b.txt", i), content})
+	}
+
+	const shards = 4
+	write := func() []bytes.Buffer {
+		out := make([]bytes.Buffer, shards)
+		err := WriteResultsSharded(Cfg{Paths: []string{root}}, shards, func(shard int) (io.Writer, error) {
+			return &out[shard], nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	first, second := write(), write()
+
+	groups := 0
+	for shard := range first {
+		if !bytes.Equal(first[shard].Bytes(), second[shard].Bytes()) {
+			t.Errorf("Expected shard %d to be identical across runs", shard)
+		}
+
+		for _, line := range strings.Split(first[shard].String(), "\n") {
+			if line == "" {
+				continue
+			}
+
+			var record groupRecord
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatal(err)
+			}
+			if shardOf(record.Key, shards) != shard {
+				t.Errorf("Expected %s in shard %d, got %d", record.Key, shardOf(record.Key, shards), shard)
+			}
+			groups++
+		}
+	}
+
+	if groups != 20 {
+		t.Errorf("Expected 20 groups across all shards, got %d", groups)
+	}
+}
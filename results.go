@@ -0,0 +1,437 @@
+package filecollate
+
+import (
+	"cmp"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// A single file of a FileGroup.
+type FileGroupMember struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Dev     uint64 // Device of the file on Unix, zero elsewhere.
+	Ino     uint64 // Inode of the file on Unix, zero elsewhere.
+	Type    MemberType
+}
+
+// How a FileGroupMember relates to the other members of its group, which tells whether deleting it
+// actually frees a copy.
+type MemberType int
+
+const (
+	MemberRegular  MemberType = iota // Regular file with contents of its own.
+	MemberHardlink                   // Shares its inode with another member, only in the detailed results.
+	MemberSymlink                    // Symlink to a file or below a followed symlink, see Cfg.IncludeSymlinks.
+)
+
+// Detailed group of files that share the same key, as returned by GetDetailedResults.
+type FileGroup struct {
+	Key         string
+	Members     []FileGroupMember
+	GroupSize   int64 // Size of a single member, since they're all identical.
+	WastedBytes int64 // Bytes taken up by all but one copy, symlinks and hardlink siblings take up none.
+
+	// Whether the members' modification times span more than Cfg.MaxModTimeSpread, only set if
+	// Cfg.FlagModTimeSpread is enabled (otherwise such groups are dropped).
+	ModTimeSpreadExceeded bool
+
+	// Whether the members are of more than one MemberType, e.g. copies mixed with hardlinks or
+	// symlinks, which a cleanup must not treat alike.
+	Mixed bool
+
+	// Whether at least two members have names differing only in case (e.g. "Report.txt" and
+	// "report.txt"), which often points at a sync problem, since they'd collide on a case-insensitive
+	// filesystem. Only the base names are compared, regardless of the dirs of the members.
+	CaseOnlyNameDiff bool
+
+	// Members left out of Members by Cfg.MaxPathsPerGroup, and the num of members including them.
+	Omitted      []FileGroupMember
+	TotalMembers int
+}
+
+// Returns the duration between the oldest and newest modification time of the group's members.
+func (g *FileGroup) ModTimeSpread() time.Duration {
+	var oldest, newest time.Time
+	for _, m := range g.AllMembers() {
+		if m.ModTime.IsZero() {
+			continue // Unmatched canonical path of the baseline
+		}
+		if oldest.IsZero() || m.ModTime.Before(oldest) {
+			oldest = m.ModTime
+		}
+		if m.ModTime.After(newest) {
+			newest = m.ModTime
+		}
+	}
+	return newest.Sub(oldest)
+}
+
+// Returns the Members of the group together with the Omitted ones.
+func (g *FileGroup) AllMembers() []FileGroupMember {
+	if len(g.Omitted) == 0 {
+		return g.Members
+	}
+	return append(slices.Clip(g.Members), g.Omitted...)
+}
+
+// Returns the paths of all reported members of the group, i.e. without the Omitted ones.
+func (g *FileGroup) Paths() []string {
+	paths := make([]string, len(g.Members))
+	for i, m := range g.Members {
+		paths[i] = m.Path
+	}
+	return paths
+}
+
+// Consumes the pairs and sends the results to the provided channel as a slice of FileGroups sorted
+// by key. Blocks until all pairs have been processed.
+func (fc *filecollate) consumePairsDetailed(collector chan []FileGroup) {
+	defer close(collector)
+
+	m := make(map[string][]FileGroupMember)
+
+	for key, canonical := range fc.baseline {
+		m[key] = []FileGroupMember{{Path: canonical}} // Size is unknown until a match is found
+	}
+
+	for p := range fc.reportedPairs() {
+		if fc.isCanonical(p) || !fc.admit(len(m[p.key])) {
+			continue
+		}
+		m[p.key] = append(m[p.key], newFileGroupMember(p))
+	}
+
+	var groups []FileGroup
+	for key, members := range m {
+		if len(members) <= 1 {
+			continue // Only one path for the key, not a group
+		}
+
+		size := members[len(members)-1].Size // The last member is never an unmatched canonical path
+		g := FileGroup{
+			Key:              key,
+			Members:          members,
+			GroupSize:        size,
+			Mixed:            markHardlinks(members),
+			WastedBytes:      wastedBytes(members, size),
+			CaseOnlyNameDiff: caseOnlyNameDiff(members),
+		}
+
+		if fc.maxSpread > 0 && g.ModTimeSpread() > fc.maxSpread {
+			if !fc.flagSpread {
+				continue
+			}
+			g.ModTimeSpreadExceeded = true
+		}
+
+		if fc.keeperless {
+			keeper := fc.keeper(key, g.Paths())
+			g.Members = slices.Delete(g.Members, keeper, keeper+1)
+		}
+
+		g.TotalMembers = len(g.Members)
+		if fc.maxPerGroup > 0 && len(g.Members) > fc.maxPerGroup {
+			slices.SortFunc(g.Members, func(a, b FileGroupMember) int {
+				return strings.Compare(a.Path, b.Path)
+			})
+			if fc.markKeeper {
+				// Moves the marked keeper to the last reported member, the rest stays sorted.
+				keeper := groupKeeper(g, fc.keepStrat).Path
+				i := slices.IndexFunc(g.Members, func(m FileGroupMember) bool { return m.Path == keeper })
+				if i >= fc.maxPerGroup {
+					m := g.Members[i]
+					g.Members = slices.Insert(slices.Delete(g.Members, i, i+1), fc.maxPerGroup-1, m)
+				}
+			}
+			g.Members, g.Omitted = g.Members[:fc.maxPerGroup:fc.maxPerGroup], g.Members[fc.maxPerGroup:]
+		}
+
+		groups = append(groups, g)
+	}
+
+	slices.SortFunc(groups, func(a, b FileGroup) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	collector <- groups
+}
+
+func newFileGroupMember(p *pair) FileGroupMember {
+	m := FileGroupMember{p.path, p.size, p.modTime, p.dev, p.ino, MemberRegular}
+	if p.linked {
+		m.Type = MemberSymlink
+	}
+	return m
+}
+
+// Flags the regular members sharing their inode with another regular member as hardlinks. Returns
+// whether the members are of more than one type afterwards.
+func markHardlinks(members []FileGroupMember) bool {
+	type inode struct{ dev, ino uint64 }
+	links := make(map[inode]int)
+	for _, m := range members {
+		if m.Type == MemberRegular && (m.Dev != 0 || m.Ino != 0) {
+			links[inode{m.Dev, m.Ino}]++
+		}
+	}
+
+	for i, m := range members {
+		if m.Type == MemberRegular && links[inode{m.Dev, m.Ino}] > 1 {
+			members[i].Type = MemberHardlink
+		}
+	}
+
+	for _, m := range members[1:] {
+		if m.Type != members[0].Type {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the bytes taken up by all but one copy among the provided members, where symlinks and
+// members sharing an inode with another member take up no bytes of their own.
+func wastedBytes(members []FileGroupMember, size int64) int64 {
+	return int64(max(len(copies(members))-1, 0)) * size
+}
+
+// Returns the members of the provided group which take up bytes of their own, i.e. without the
+// symlinks and with a single member per inode, the lexically smallest path among its hardlinks.
+func copies(members []FileGroupMember) []FileGroupMember {
+	type inode struct{ dev, ino uint64 }
+	seen := make(map[inode]int) // -> index in files
+
+	var files []FileGroupMember
+	for _, m := range members {
+		if m.Type == MemberSymlink {
+			continue
+		}
+		if m.Dev != 0 || m.Ino != 0 {
+			id := inode{m.Dev, m.Ino}
+			if i, ok := seen[id]; ok {
+				if m.Path < files[i].Path {
+					files[i] = m
+				}
+				continue
+			}
+			seen[id] = len(files)
+		}
+		files = append(files, m)
+	}
+	return files
+}
+
+// Checks if any two of the provided members have base names which differ only in case.
+func caseOnlyNameDiff(members []FileGroupMember) bool {
+	names := make(map[string]string, len(members)) // lowercased -> first name seen
+	for _, m := range members {
+		name := filepath.Base(m.Path)
+		folded := strings.ToLower(name)
+		if seen, ok := names[folded]; ok && seen != name {
+			return true
+		}
+		names[folded] = name
+	}
+	return false
+}
+
+// A file of a group as streamed by StreamFileResults.
+type FileResult struct {
+	FileGroupMember
+	Key       string
+	GroupSize int64 // Size of a single member of the group.
+	Index     int   // Position of the file in its group, the first member found (or the canonical path) is 0.
+}
+
+// Consumes the pairs and sends each file to the provided channel once its group is confirmed.
+// Closes the channel once all pairs have been processed.
+func (fc *filecollate) consumePairsFileStream(results chan<- FileResult) {
+	defer close(results)
+
+	m := make(map[string][]FileGroupMember)
+	keepers := make(map[string]int) // key -> index of the member withheld as keeper, if keeperless
+
+	for key, canonical := range fc.baseline {
+		m[key] = []FileGroupMember{{Path: canonical}} // Size is unknown until a match is found
+	}
+
+	send := func(r FileResult) {
+		select {
+		case results <- r:
+		case <-fc.ctx.Done(): // Receiver may be gone, keep draining without sending.
+		}
+	}
+
+	for p := range fc.reportedPairs() {
+		if fc.isCanonical(p) || !fc.admit(len(m[p.key])) {
+			continue
+		}
+
+		members := append(m[p.key], newFileGroupMember(p))
+		members[0].Size = p.size // Same content, so the same size, even for a canonical path
+		m[p.key] = members
+
+		n := len(members)
+		if n < 2 {
+			continue
+		}
+
+		if !fc.keeperless {
+			if n == 2 {
+				send(FileResult{members[0], p.key, p.size, 0})
+			}
+			send(FileResult{members[n-1], p.key, p.size, n - 1})
+			continue
+		}
+
+		// The keeper is withheld like in GetResults, a previous one is sent once it's superseded.
+		keeper := keepers[p.key] // The first member until a better one is found
+		if fc.keeper(p.key, []string{members[keeper].Path, p.path}) == 1 {
+			send(FileResult{members[keeper], p.key, p.size, keeper})
+			keepers[p.key] = n - 1
+		} else {
+			send(FileResult{members[n-1], p.key, p.size, n - 1})
+		}
+	}
+}
+
+// Returns the groups for which the provided predicate returns true, e.g. to only keep groups with
+// a member under a certain directory and a size above a threshold.
+func FilterGroups(groups []FileGroup, pred func(FileGroup) bool) []FileGroup {
+	var filtered []FileGroup
+	for _, g := range groups {
+		if pred(g) {
+			filtered = append(filtered, g)
+		}
+	}
+	return filtered
+}
+
+// Duplicates within a single directory, as returned by TopDuplicateDirs.
+type DirStat struct {
+	Dir   string
+	Files int   // Duplicate files in the dir, which free space and can be deleted while a copy remains.
+	Bytes int64 // Bytes freed by deleting the duplicate files.
+}
+
+// Returns the n directories with the most duplicate files among the provided groups, ties are
+// broken by the lexically smallest dir. A file counts as a duplicate if a copy of it remains after
+// deleting it, i.e. all members count if the group spans other dirs, and all but one otherwise.
+// Like for FileGroup.WastedBytes, symlinks and all but one hardlink to the same inode don't count,
+// since deleting them frees nothing.
+func TopDuplicateDirs(groups []FileGroup, n int) []DirStat {
+	return topDuplicateDirs(groups, n, func(a, b DirStat) int {
+		return cmp.Compare(b.Files, a.Files)
+	})
+}
+
+// Same as TopDuplicateDirs, but ranked by the bytes freed by deleting the duplicate files.
+func TopDuplicateDirsByBytes(groups []FileGroup, n int) []DirStat {
+	return topDuplicateDirs(groups, n, func(a, b DirStat) int {
+		return cmp.Compare(b.Bytes, a.Bytes)
+	})
+}
+
+func topDuplicateDirs(groups []FileGroup, n int, rank func(a, b DirStat) int) []DirStat {
+	stats := make(map[string]*DirStat)
+
+	for _, g := range groups {
+		perDir := make(map[string]int)
+		for _, m := range copies(g.AllMembers()) {
+			perDir[filepath.Dir(m.Path)]++
+		}
+
+		for dir, count := range perDir {
+			if len(perDir) == 1 {
+				count-- // A copy must remain in the dir
+			}
+			if count == 0 {
+				continue
+			}
+
+			s, ok := stats[dir]
+			if !ok {
+				s = &DirStat{Dir: dir}
+				stats[dir] = s
+			}
+			s.Files += count
+			s.Bytes += int64(count) * g.GroupSize
+		}
+	}
+
+	sorted := make([]DirStat, 0, len(stats))
+	for _, s := range stats {
+		sorted = append(sorted, *s)
+	}
+
+	slices.SortFunc(sorted, func(a, b DirStat) int {
+		if c := rank(a, b); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Dir, b.Dir)
+	})
+
+	return sorted[:max(0, min(n, len(sorted)))]
+}
+
+// Duplicates of a single file extension, as returned by ExtStats.
+type ExtStat struct {
+	Ext   string // Lowercase extension including the dot, empty for files without one.
+	Files int    // Duplicate files with the extension, counted like DirStat.Files (without links).
+	Bytes int64  // Bytes freed by deleting the duplicate files.
+}
+
+// Aggregates the provided groups per file extension (case-insensitive), e.g. to find out which kind
+// of files takes up most of the wasted space. A file counts as a duplicate if a copy of it remains
+// after deleting it, i.e. all members count if the group spans other extensions, and all but one
+// otherwise, while symlinks and all but one hardlink to the same inode don't count, like in
+// TopDuplicateDirs.
+func ExtStats(groups []FileGroup) map[string]ExtStat {
+	stats := make(map[string]ExtStat)
+
+	for _, g := range groups {
+		perExt := make(map[string]int)
+		for _, m := range copies(g.AllMembers()) {
+			perExt[strings.ToLower(filepath.Ext(m.Path))]++
+		}
+
+		for ext, count := range perExt {
+			if len(perExt) == 1 {
+				count-- // A copy must remain with the extension
+			}
+			if count == 0 {
+				continue
+			}
+
+			s := stats[ext]
+			s.Ext = ext
+			s.Files += count
+			s.Bytes += int64(count) * g.GroupSize
+			stats[ext] = s
+		}
+	}
+
+	return stats
+}
+
+// Returns the provided stats sorted by their bytes, ties are broken by the num of files and then the
+// extension.
+func SortedExtStats(stats map[string]ExtStat) []ExtStat {
+	sorted := maps.Values(stats)
+	slices.SortFunc(sorted, func(a, b ExtStat) int {
+		if c := cmp.Compare(b.Bytes, a.Bytes); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.Files, a.Files); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Ext, b.Ext)
+	})
+	return sorted
+}
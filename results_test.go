@@ -0,0 +1,436 @@
+package filecollate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+func TestGetDetailedResults(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root,
+		[2]string{"a.txt", "0123456789"},
+		[2]string{"b.txt", "0123456789"},
+		[2]string{"c.txt", "0123456789"},
+		[2]string{"d.txt", "unique"},
+	)
+
+	groups, err := GetDetailedResults(Cfg{Paths: []string{root}, Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 1 {
+		t.Fatalf("Expected a single group, got %v", groups)
+	}
+
+	g := groups[0]
+	if len(g.Members) != 3 {
+		t.Errorf("Expected 3 members, got %d", len(g.Members))
+	}
+
+	if g.GroupSize != 10 {
+		t.Errorf("Expected group size to be 10, got %d", g.GroupSize)
+	}
+
+	if g.WastedBytes != 20 {
+		t.Errorf("Expected wasted bytes to be 20, got %d", g.WastedBytes)
+	}
+}
+
+func TestMaxModTimeSpread(t *testing.T) {
+	root := t.TempDir()
+	paths := writeFiles(t, root,
+		[2]string{"a.txt", "recent"},
+		[2]string{"b.txt", "recent"},
+		[2]string{"c.txt", "old"},
+		[2]string{"d.txt", "old"},
+	)
+
+	now := time.Now()
+	os.Chtimes(paths[1], now, now.Add(-time.Minute))
+	os.Chtimes(paths[3], now, now.Add(-48*time.Hour))
+
+	cfg := Cfg{Paths: []string{root}, Workers: 4, MaxModTimeSpread: time.Hour}
+
+	groups, err := GetDetailedResults(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 1 || groups[0].ModTimeSpread() > time.Hour {
+		t.Fatalf("Expected only the recent group, got %v", groups)
+	}
+
+	cfg.FlagModTimeSpread = true
+
+	groups, err = GetDetailedResults(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flagged := 0
+	for _, g := range groups {
+		if g.ModTimeSpreadExceeded {
+			flagged++
+		}
+	}
+
+	if len(groups) != 2 || flagged != 1 {
+		t.Errorf("Expected 2 groups with 1 flagged, got %d groups with %d flagged", len(groups), flagged)
+	}
+}
+
+func TestDetailedResultsFileID(t *testing.T) {
+	root := t.TempDir()
+	paths := writeFiles(t, root, [2]string{"a.txt", "dupe"})
+	if err := os.Link(paths[0], filepath.Join(root, "b.txt")); err != nil {
+		t.Skipf("Hardlinks are not supported: %v", err)
+	}
+
+	groups, err := GetDetailedResults(Cfg{Paths: []string{root}, Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 1 || len(groups[0].Members) != 2 {
+		t.Fatalf("Expected a single group with 2 members, got %v", groups)
+	}
+
+	a, b := groups[0].Members[0], groups[0].Members[1]
+	if a.Dev != b.Dev || a.Ino != b.Ino {
+		t.Errorf("Expected hardlinks to share device and inode, got %d:%d and %d:%d", a.Dev, a.Ino, b.Dev, b.Ino)
+	}
+
+	if runtime.GOOS != "windows" && a.Ino == 0 {
+		t.Error("Expected inode to be populated")
+	}
+}
+
+func TestDetailedResultsMemberTypes(t *testing.T) {
+	root := t.TempDir()
+	paths := writeFiles(t, root, [2]string{"a.txt", "dupe"}, [2]string{"b.txt", "dupe"})
+	if err := os.Link(paths[0], filepath.Join(root, "c.txt")); err != nil {
+		t.Skipf("Hardlinks are not supported: %v", err)
+	}
+	if err := os.Symlink(paths[1], filepath.Join(root, "d.txt")); err != nil {
+		t.Skipf("Symlinks are not supported: %v", err)
+	}
+
+	groups, err := GetDetailedResults(Cfg{Paths: []string{root}, Workers: 4, IncludeSymlinks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 1 || !groups[0].Mixed {
+		t.Fatalf("Expected a single mixed group, got %v", groups)
+	}
+
+	types := make(map[string]MemberType)
+	for _, m := range groups[0].Members {
+		types[filepath.Base(m.Path)] = m.Type
+	}
+
+	expected := map[string]MemberType{
+		"a.txt": MemberHardlink,
+		"b.txt": MemberRegular,
+		"c.txt": MemberHardlink,
+		"d.txt": MemberSymlink,
+	}
+	if !reflect.DeepEqual(types, expected) {
+		t.Errorf("Expected member types %v, got %v", expected, types)
+	}
+
+	// Only b.txt is a copy of its own, the hardlink and the symlink take up no extra bytes.
+	if groups[0].WastedBytes != 4 {
+		t.Errorf("Expected 4 wasted bytes, got %d", groups[0].WastedBytes)
+	}
+
+	groupsChan := make(chan []string)
+	go func() {
+		for range groupsChan {
+		}
+	}()
+	summary, err := StreamResultsWithSummary(context.Background(), Cfg{Paths: []string{root}, Workers: 4, IncludeSymlinks: true}, groupsChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Duplicates != 3 || summary.WastedBytes != 4 {
+		t.Errorf("Expected 3 duplicates and 4 wasted bytes in the summary, got %+v", summary)
+	}
+
+	// Symlinks are left out by default.
+	groups, err = GetDetailedResults(Cfg{Paths: []string{root}, Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || len(groups[0].Members) != 3 {
+		t.Errorf("Expected a single group without the symlink, got %v", groups)
+	}
+}
+
+func TestCaseOnlyNameDiff(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root,
+		[2]string{"Report.txt", "report"},
+		[2]string{"report.txt", "report"},
+		[2]string{"a.txt", "other"},
+		[2]string{"b.txt", "other"},
+	)
+
+	groups, err := GetDetailedResults(Cfg{Paths: []string{root}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %+v", groups)
+	}
+	for _, g := range groups {
+		report := strings.EqualFold(filepath.Base(g.Members[0].Path), "report.txt")
+		if g.CaseOnlyNameDiff != report {
+			t.Errorf("Expected only the report group to be flagged, got %+v", g)
+		}
+	}
+
+	tests := []struct {
+		paths    []string
+		expected bool
+	}{
+		{[]string{"a/Photo.JPG", "b/photo.jpg"}, true},
+		{[]string{"a/photo.jpg", "b/photo.jpg"}, false}, // Same name in different dirs
+		{[]string{"a/x.txt", "a/y.txt", "b/X.txt"}, true},
+		{[]string{"a/x.txt", "a/y.txt"}, false},
+	}
+	for _, tt := range tests {
+		var members []FileGroupMember
+		for _, path := range tt.paths {
+			members = append(members, FileGroupMember{Path: path})
+		}
+		if got := caseOnlyNameDiff(members); got != tt.expected {
+			t.Errorf("%v: expected %t, got %t", tt.paths, tt.expected, got)
+		}
+	}
+}
+
+func TestFilterGroups(t *testing.T) {
+	groups := []FileGroup{
+		{Key: "big", GroupSize: 2 << 30, Members: []FileGroupMember{{Path: "/downloads/movie.mkv"}, {Path: "/media/movie.mkv"}}},
+		{Key: "small", GroupSize: 1024, Members: []FileGroupMember{{Path: "/downloads/notes.txt"}, {Path: "/docs/notes.txt"}}},
+		{Key: "elsewhere", GroupSize: 4 << 30, Members: []FileGroupMember{{Path: "/media/a.iso"}, {Path: "/backup/a.iso"}}},
+	}
+
+	inDownloads := func(g FileGroup) bool {
+		for _, m := range g.Members {
+			if strings.HasPrefix(m.Path, "/downloads/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	overGiB := func(g FileGroup) bool {
+		return g.GroupSize > 1<<30
+	}
+
+	filtered := FilterGroups(groups, func(g FileGroup) bool {
+		return inDownloads(g) && overGiB(g)
+	})
+
+	if len(filtered) != 1 || filtered[0].Key != "big" {
+		t.Errorf("Expected only the big group, got %v", filtered)
+	}
+
+	if len(FilterGroups(groups, overGiB)) != 2 {
+		t.Errorf("Expected 2 groups over 1GiB")
+	}
+}
+
+func TestStreamFileResults(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root,
+		[2]string{"a.txt", "0123456789"},
+		[2]string{"b.txt", "0123456789"},
+		[2]string{"c.txt", "0123456789"},
+		[2]string{"d.txt", "unique"},
+	)
+
+	results := make(chan FileResult)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StreamFileResults(context.Background(), Cfg{Paths: []string{root}}, results)
+	}()
+
+	indexes := make(map[int]bool)
+	count := 0
+	for r := range results {
+		count++
+		if r.Size != 10 || r.GroupSize != 10 || r.ModTime.IsZero() || strings.HasSuffix(r.Path, "d.txt") {
+			t.Errorf("Unexpected result %+v", r)
+		}
+		indexes[r.Index] = true
+	}
+
+	if err := <-errChan; err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 || len(indexes) != 3 {
+		t.Errorf("Expected each of the 3 members sent once, got indexes %v", indexes)
+	}
+}
+
+func TestStreamFileResultsExcludeKeeper(t *testing.T) {
+	root := createSmallFilesTree(t, 4, 10)
+	c := Cfg{Paths: []string{root}, Workers: 4, ExcludeKeeper: true}
+
+	groups, err := GetResults(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := make(map[string][]string)
+	for key, paths := range groups {
+		expected[key] = slices.Clone(paths)
+		slices.Sort(expected[key])
+	}
+
+	results := make(chan FileResult)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StreamFileResults(context.Background(), c, results)
+	}()
+
+	streamed := make(map[string][]string)
+	for r := range results {
+		streamed[r.Key] = append(streamed[r.Key], r.Path)
+	}
+	if err := <-errChan; err != nil {
+		t.Fatal(err)
+	}
+	for _, paths := range streamed {
+		slices.Sort(paths)
+	}
+
+	if !reflect.DeepEqual(streamed, expected) {
+		t.Errorf("Expected the streamed files to match GetResults %v, got %v", expected, streamed)
+	}
+}
+
+func TestTopDuplicateDirs(t *testing.T) {
+	group := func(size int64, paths ...string) FileGroup {
+		g := FileGroup{GroupSize: size}
+		for _, path := range paths {
+			g.Members = append(g.Members, FileGroupMember{Path: path, Size: size})
+		}
+		return g
+	}
+
+	groups := []FileGroup{
+		group(10, "/photos/a.jpg", "/downloads/a.jpg", "/downloads/a (1).jpg"),
+		group(1000, "/photos/big.mov", "/backup/big.mov"),
+		group(5, "/docs/x.txt", "/docs/y.txt"), // Only within one dir, one copy stays
+	}
+
+	byCount := TopDuplicateDirs(groups, 2)
+	expected := []DirStat{{"/downloads", 2, 20}, {"/photos", 2, 1010}} // Tie broken lexically
+	if !reflect.DeepEqual(byCount, expected) {
+		t.Errorf("Expected %v, got %v", expected, byCount)
+	}
+
+	byBytes := TopDuplicateDirsByBytes(groups, 10)
+	expected = []DirStat{{"/photos", 2, 1010}, {"/backup", 1, 1000}, {"/downloads", 2, 20}, {"/docs", 1, 5}}
+	if !reflect.DeepEqual(byBytes, expected) {
+		t.Errorf("Expected %v, got %v", expected, byBytes)
+	}
+
+	// Symlinks and hardlinks to a counted inode free nothing.
+	linked := []FileGroup{{GroupSize: 10, Members: []FileGroupMember{
+		{Path: "/music/a.mp3", Dev: 1, Ino: 1, Type: MemberHardlink},
+		{Path: "/music/b.mp3", Dev: 1, Ino: 1, Type: MemberHardlink},
+		{Path: "/links/a.mp3", Type: MemberSymlink},
+		{Path: "/other/a.mp3", Dev: 1, Ino: 2},
+	}}}
+	expected = []DirStat{{"/music", 1, 10}, {"/other", 1, 10}}
+	if got := TopDuplicateDirs(linked, 10); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestExtStats(t *testing.T) {
+	groups := []FileGroup{
+		{GroupSize: 10, Members: []FileGroupMember{{Path: "/a/photo.JPG"}, {Path: "/b/photo.jpg"}}},
+		{GroupSize: 1000, Members: []FileGroupMember{{Path: "/photos/big.mov"}, {Path: "/backup/big.mov.bak"}}}, // Either can go
+		{GroupSize: 5, Members: []FileGroupMember{{Path: "/docs/README"}, {Path: "/docs/old/README"}}},
+	}
+
+	stats := ExtStats(groups)
+	expected := map[string]ExtStat{
+		".jpg": {".jpg", 1, 10},
+		".mov": {".mov", 1, 1000},
+		".bak": {".bak", 1, 1000},
+		"":     {"", 1, 5},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Expected %v, got %v", expected, stats)
+	}
+
+	sorted := SortedExtStats(stats)
+	expectedSorted := []ExtStat{expected[".bak"], expected[".mov"], expected[".jpg"], expected[""]}
+	if !reflect.DeepEqual(sorted, expectedSorted) {
+		t.Errorf("Expected %v, got %v", expectedSorted, sorted)
+	}
+
+	// Symlinks and hardlinks to a counted inode free nothing.
+	linked := []FileGroup{{GroupSize: 10, Members: []FileGroupMember{
+		{Path: "/music/a.mp3", Dev: 1, Ino: 1, Type: MemberHardlink},
+		{Path: "/music/b.lnk", Dev: 1, Ino: 1, Type: MemberHardlink},
+		{Path: "/links/a.wav", Type: MemberSymlink},
+		{Path: "/other/a.mp3", Dev: 1, Ino: 2},
+	}}}
+	expected = map[string]ExtStat{".mp3": {".mp3", 1, 10}}
+	if got := ExtStats(linked); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestMaxPathsPerGroup(t *testing.T) {
+	root := t.TempDir()
+	paths := writeFiles(t, root,
+		[2]string{"e.txt", "dupe"},
+		[2]string{"d.txt", "dupe"},
+		[2]string{"c.txt", "dupe"},
+		[2]string{"b.txt", "dupe"},
+		[2]string{"a.txt", "dupe"},
+	)
+
+	groups, err := GetDetailedResults(Cfg{Paths: []string{root}, Workers: 4, MaxPathsPerGroup: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 1 {
+		t.Fatalf("Expected a single group, got %v", groups)
+	}
+
+	g := groups[0]
+	if expected := []string{paths[4], paths[3]}; !reflect.DeepEqual(g.Paths(), expected) {
+		t.Errorf("Expected the reported members %v, got %v", expected, g.Paths())
+	}
+	if g.TotalMembers != 5 || len(g.Omitted) != 3 || g.WastedBytes != 16 {
+		t.Errorf("Expected 5 members with 3 omitted and 16 wasted bytes, got %d, %d and %d", g.TotalMembers, len(g.Omitted), g.WastedBytes)
+	}
+
+	plan, err := PlanCleanup(groups, CleanupOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Actions[0].Delete) != 4 {
+		t.Errorf("Expected all but the keeper to be deletable, got %v", plan.Actions[0].Delete)
+	}
+}
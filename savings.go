@@ -0,0 +1,113 @@
+package filecollate
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Returns the bytes freed on each device (as in FileGroupMember.Dev) by deleting all but one member
+// of each of the provided groups, e.g. to see how much deduplicating frees on each disk. The member
+// kept is the lexically smallest path of its group, hardlinks only free their bytes once the last
+// link is deleted and symlinks free nothing. Where device info is unavailable (not Unix), all
+// savings are reported for device 0.
+func SavingsByDevice(groups []FileGroup) map[uint64]int64 {
+	type inode struct{ dev, ino uint64 }
+	savings := make(map[uint64]int64)
+
+	for _, g := range groups {
+		var files []FileGroupMember
+		for _, m := range g.AllMembers() {
+			if m.Type != MemberSymlink {
+				files = append(files, m)
+			}
+		}
+		if len(files) < 2 {
+			continue
+		}
+
+		keeper := files[0]
+		for _, m := range files[1:] {
+			if m.Path < keeper.Path {
+				keeper = m
+			}
+		}
+
+		seen := map[inode]bool{{keeper.Dev, keeper.Ino}: true}
+		for _, m := range files {
+			if m.Path == keeper.Path {
+				continue
+			}
+			if m.Dev != 0 || m.Ino != 0 {
+				id := inode{m.Dev, m.Ino}
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+			}
+			savings[m.Dev] += g.GroupSize
+		}
+	}
+
+	return savings
+}
+
+// Same as SavingsByDevice, but keyed by the mount point of each device, which is resolved from the
+// paths of the members on it. Devices whose mount point can't be resolved (e.g. since the files are
+// gone) are keyed by their device id in decimal instead.
+func SavingsByMount(groups []FileGroup) map[string]int64 {
+	paths := make(map[uint64]string) // device -> path of a member on it
+	for _, g := range groups {
+		for _, m := range g.AllMembers() {
+			if _, ok := paths[m.Dev]; !ok && m.Type != MemberSymlink {
+				paths[m.Dev] = m.Path
+			}
+		}
+	}
+
+	savings := make(map[string]int64)
+	for dev, bytes := range SavingsByDevice(groups) {
+		mount, ok := mountPoint(dev, paths[dev])
+		if !ok {
+			mount = strconv.FormatUint(dev, 10)
+		}
+		savings[mount] += bytes
+	}
+	return savings
+}
+
+// Returns the mount point of the provided device, i.e. the topmost dir above the provided path
+// that's still on the device.
+func mountPoint(dev uint64, path string) (string, bool) {
+	if dev == 0 || path == "" {
+		return "", false
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return "", false
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return "", false
+	}
+	if d, _ := fileID(fi); d != dev {
+		return "", false // Moved to another device since the search
+	}
+
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir, true // Root of the filesystem
+		}
+
+		fi, err := os.Stat(parent)
+		if err != nil {
+			return dir, true
+		}
+		if d, _ := fileID(fi); d != dev {
+			return dir, true
+		}
+		dir = parent
+	}
+}
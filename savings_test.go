@@ -0,0 +1,59 @@
+package filecollate
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSavingsByDevice(t *testing.T) {
+	groups := []FileGroup{
+		{
+			GroupSize: 10,
+			Members: []FileGroupMember{
+				{Path: "/a/x.txt", Dev: 1, Ino: 1}, // Kept
+				{Path: "/b/x.txt", Dev: 1, Ino: 2},
+				{Path: "/c/x.txt", Dev: 1, Ino: 2, Type: MemberHardlink}, // Freed with /b/x.txt
+				{Path: "/d/x.txt", Dev: 2, Ino: 1},
+				{Path: "/e/x.txt", Dev: 2, Ino: 3, Type: MemberSymlink},
+			},
+		},
+		{
+			GroupSize: 100,
+			Members: []FileGroupMember{
+				{Path: "/a/y.txt", Dev: 2, Ino: 5},
+				{Path: "/b/y.txt", Dev: 2, Ino: 6},
+			},
+		},
+	}
+
+	expected := map[uint64]int64{1: 10, 2: 110}
+	if savings := SavingsByDevice(groups); !reflect.DeepEqual(savings, expected) {
+		t.Errorf("Expected %v, got %v", expected, savings)
+	}
+}
+
+func TestSavingsByMount(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, [2]string{"a.txt", "dupe"}, [2]string{"b.txt", "dupe"})
+
+	groups, err := GetDetailedResults(Cfg{Paths: []string{root}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	savings := SavingsByMount(groups)
+	if len(savings) != 1 {
+		t.Fatalf("Expected savings on a single mount, got %v", savings)
+	}
+
+	for mount, bytes := range savings {
+		if groups[0].Members[0].Dev != 0 && !strings.HasPrefix(root, filepath.Clean(mount)) {
+			t.Errorf("Expected the mount point %s to contain %s", mount, root)
+		}
+		if bytes != 4 {
+			t.Errorf("Expected 4 bytes to be freed, got %d", bytes)
+		}
+	}
+}
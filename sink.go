@@ -0,0 +1,87 @@
+package filecollate
+
+import (
+	"context"
+	"sync"
+
+	"github.com/puzpuzpuz/xsync/v3"
+)
+
+// Accumulates the results of a search, e.g. to stream them into a database or a custom aggregator
+// instead of the in-memory map of GetResults.
+//
+// AddPair is called with the key and path of every scanned file (and every canonical path of the
+// BaselineDB beforehand) from many goroutines at once (one after another in the order the files
+// were found with OrderedStream), so it must be safe for concurrent use. Finalize
+// is called exactly once after the last AddPair, even if the search failed.
+type ResultSink interface {
+	AddPair(key, path string)
+	Finalize() error
+}
+
+// Runs the search and feeds every scanned file to the provided ResultSink. Returns the error of the
+// search, or otherwise the error of the sink's Finalize.
+func ScanInto(ctx context.Context, c Cfg, sink ResultSink) error {
+	done := make(chan struct{})
+	err := run(ctx, c, func(fc *filecollate) {
+		defer close(done)
+		feeders := fc.numWorkers
+		if fc.ordered {
+			feeders = 1
+		}
+		fc.feedSink(sink, feeders)
+	})
+	<-done
+
+	if finalizeErr := sink.Finalize(); err == nil {
+		err = finalizeErr
+	}
+	return err
+}
+
+// Default ResultSink of GetResults, which groups the paths by key in memory.
+type mapSink struct {
+	m     *xsync.MapOf[string, []string]
+	admit func(groupLen int) bool // whether a path may join a group of the provided len
+}
+
+func newMapSink(admit func(groupLen int) bool) *mapSink {
+	return &mapSink{xsync.NewMapOf[string, []string](), admit}
+}
+
+func (s *mapSink) AddPair(key, path string) {
+	s.m.Compute(key, func(paths []string, _ bool) ([]string, bool) {
+		if !s.admit(len(paths)) {
+			return paths, false
+		}
+		return append(paths, path), false
+	})
+}
+
+func (s *mapSink) Finalize() error {
+	return nil
+}
+
+// Feeds the canonical paths of the baseline and then the pairs to the provided sink from the
+// provided num of goroutines, a single one keeps the order of the pairs. Blocks until all pairs
+// have been fed.
+func (fc *filecollate) feedSink(sink ResultSink, feeders int) {
+	for key, canonical := range fc.baseline {
+		sink.AddPair(key, canonical)
+	}
+
+	pairs := fc.reportedPairs()
+	var wg sync.WaitGroup
+	for range feeders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range pairs {
+				if !fc.isCanonical(p) {
+					sink.AddPair(p.key, p.path)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,96 @@
+package filecollate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+type countingSink struct {
+	mu        sync.Mutex
+	keys      map[string]int
+	finalized int
+	err       error
+}
+
+func (s *countingSink) AddPair(key, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key]++
+}
+
+func (s *countingSink) Finalize() error {
+	s.finalized++
+	return s.err
+}
+
+func TestScanInto(t *testing.T) {
+	root := createSmallFilesTree(t, 4, 10)
+
+	sink := &countingSink{keys: make(map[string]int)}
+	if err := ScanInto(context.Background(), Cfg{Paths: []string{root}, Workers: 4}, sink); err != nil {
+		t.Fatal(err)
+	}
+
+	total := 0
+	for _, n := range sink.keys {
+		total += n
+	}
+	if total != 40 || len(sink.keys) != 6 || sink.finalized != 1 {
+		t.Errorf("Expected 40 files with 6 keys finalized once, got %d files with %d keys finalized %d times", total, len(sink.keys), sink.finalized)
+	}
+
+	errFinalize := errors.New("finalize")
+	sink = &countingSink{keys: make(map[string]int), err: errFinalize}
+	if err := ScanInto(context.Background(), Cfg{Paths: []string{root}}, sink); !errors.Is(err, errFinalize) {
+		t.Errorf("Expected the Finalize error, got %v", err)
+	}
+}
+
+type recordingSink struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (s *recordingSink) AddPair(_, path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths = append(s.paths, path)
+}
+
+func (s *recordingSink) Finalize() error { return nil }
+
+func TestScanIntoOrdered(t *testing.T) {
+	root := createSmallFilesTree(t, 4, 10)
+
+	sink := &recordingSink{}
+	if err := ScanInto(context.Background(), Cfg{Paths: []string{root}, OrderedStream: true}, sink); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.paths) != 40 || !slices.IsSorted(sink.paths) {
+		t.Errorf("Expected all 40 files in walk order, got %v", sink.paths)
+	}
+
+	// The built-in map sink keeps the walk order within each group, even with many workers.
+	root = t.TempDir()
+	for i := range 300 {
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("file%03d", i)), []byte("same"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	results, err := GetResults(Cfg{Paths: []string{root}, Workers: 8, deterministic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, paths := range results {
+		if len(paths) != 300 || !slices.IsSorted(paths) {
+			t.Errorf("Expected the 300 paths of %s in walk order, got %v", key, paths)
+		}
+	}
+}
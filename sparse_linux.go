@@ -0,0 +1,37 @@
+//go:build linux
+
+package filecollate
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Returns the [start, end) offsets of the data regions of the provided file, leaving out its holes.
+// Fails if the filesystem doesn't support SEEK_DATA.
+func dataRegions(file *os.File, size int64) ([][2]int64, error) {
+	fd := int(file.Fd())
+
+	var regions [][2]int64
+	for off := int64(0); off < size; {
+		start, err := unix.Seek(fd, off, unix.SEEK_DATA)
+		if errors.Is(err, unix.ENXIO) {
+			break // Only a hole up to the end of the file
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		end, err := unix.Seek(fd, start, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, err
+		}
+
+		regions = append(regions, [2]int64{start, min(end, size)})
+		off = end
+	}
+
+	return regions, nil
+}
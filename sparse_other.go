@@ -0,0 +1,13 @@
+//go:build !linux
+
+package filecollate
+
+import (
+	"errors"
+	"os"
+)
+
+// SEEK_DATA is only used on Linux, so sparse files are read entirely elsewhere.
+func dataRegions(file *os.File, size int64) ([][2]int64, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,66 @@
+package filecollate
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSparseAwareHashKeyGenerator(t *testing.T) {
+	dir := t.TempDir()
+	const size = 1 << 20
+	data := bytes.Repeat([]byte("data"), 3000) // Spans multiple blocks
+
+	// Writes the data at the provided offsets of a file of the provided size, leaving holes elsewhere.
+	sparse := func(name string, size int64, offsets ...int64) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := f.Truncate(size); err != nil {
+			t.Fatal(err)
+		}
+		for _, off := range offsets {
+			if _, err := f.WriteAt(data, off); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return path
+	}
+
+	// Same contents, but with the zeros allocated instead of holes.
+	dense := filepath.Join(dir, "dense")
+	contents := make([]byte, size)
+	copy(contents[5000:], data)
+	copy(contents[size/2:], data)
+	if err := os.WriteFile(dense, contents, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	key := func(path string) string {
+		key, err := SparseAwareHashKeyGenerator(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	base := key(sparse("sparse", size, 5000, size/2))
+	if got := key(dense); got != base {
+		t.Errorf("Expected the dense file to match the sparse one, got %s and %s", got, base)
+	}
+
+	tests := map[string]string{
+		"moved data":     sparse("moved", size, 5000, size/2+sparseBlockSize),
+		"other size":     sparse("bigger", size+1, 5000, size/2),
+		"missing region": sparse("missing", size, 5000),
+	}
+	for name, path := range tests {
+		if key(path) == base {
+			t.Errorf("%s: expected a different key", name)
+		}
+	}
+}
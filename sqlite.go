@@ -0,0 +1,136 @@
+package filecollate
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Schema created by WriteResultsSQLite, if the tables don't exist yet.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS groups (
+	key    TEXT PRIMARY KEY,
+	size   INTEGER NOT NULL,
+	keeper TEXT
+);
+CREATE TABLE IF NOT EXISTS files (
+	group_key TEXT NOT NULL REFERENCES groups (key),
+	path      TEXT NOT NULL,
+	size      INTEGER NOT NULL,
+	mod_time  INTEGER,
+	PRIMARY KEY (group_key, path)
+);`
+
+// Runs the search and inserts the groups into the provided SQLite database as they're confirmed,
+// so that the results can be queried with SQL (e.g. joined with other inventories) without holding
+// them in memory. The groups table holds the key and member size of each group, and the files table
+// the path, size and modification time (unix nanoseconds, NULL if unknown) of each member. With
+// Cfg.MarkKeeper, the keeper column of the groups table holds the path of the keeper among the
+// members inserted so far, which is the final keeper once the search is done.
+//
+// Every insert is a transaction of its own, which either adds a new group with its first two
+// members or a further member of a known group, so a crash leaves the database consistent with only
+// the last members missing. The database is opened by the caller with any database/sql SQLite
+// driver instead of being opened from a path here, so that the library doesn't depend on one. The
+// inserts upsert the groups with ON CONFLICT, which requires SQLite 3.24 or newer.
+func WriteResultsSQLite(ctx context.Context, c Cfg, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, sqliteSchema); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan FileResult)
+	searchErr := make(chan error, 1)
+	go func() {
+		searchErr <- StreamFileResults(ctx, c, results)
+	}()
+
+	keepers := make(map[string]FileGroupMember) // key -> keeper among the members written so far
+
+	var writeErr error
+	var first *FileResult // First member of a group, only written together with the second one
+	for r := range results {
+		if writeErr != nil {
+			continue // Drain until the search has shut down
+		}
+
+		if r.Index == 0 && !c.ExcludeKeeper { // Without the keeper, every file is sent on its own
+			first = &r
+			continue
+		}
+
+		batch := []FileResult{r}
+		if r.Index == 1 && first != nil && first.Key == r.Key {
+			batch = []FileResult{*first, r}
+		}
+		first = nil
+
+		var keeper sql.NullString
+		if c.MarkKeeper {
+			keeper = sql.NullString{String: updateKeeper(keepers, batch, c.KeepStrategy), Valid: true}
+		}
+
+		if writeErr = insertResults(ctx, db, batch, keeper); writeErr != nil {
+			cancel()
+		}
+	}
+
+	if err := <-searchErr; writeErr == nil {
+		return err
+	}
+	return writeErr
+}
+
+// Updates the keeper of the group of the provided members like groupKeeper picks it and returns
+// its path.
+func updateKeeper(keepers map[string]FileGroupMember, batch []FileResult, strategy KeepStrategy) string {
+	key := batch[0].Key
+	for _, r := range batch {
+		keeper, ok := keepers[key]
+		switch {
+		case !ok, keeper.Type == MemberSymlink && r.Type != MemberSymlink:
+			keepers[key] = r.FileGroupMember
+		case (keeper.Type == MemberSymlink) == (r.Type == MemberSymlink) && keepsBefore(r.FileGroupMember, keeper, strategy):
+			keepers[key] = r.FileGroupMember
+		}
+	}
+	return keepers[key].Path
+}
+
+// Inserts the provided members of the same group in a single transaction, setting the keeper of
+// the group if valid.
+func insertResults(ctx context.Context, db *sql.DB, batch []FileResult, keeper sql.NullString) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // No-op once committed
+
+	r := batch[0]
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO groups (key, size, keeper) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET keeper = coalesce(excluded.keeper, keeper)`,
+		r.Key, r.GroupSize, keeper,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range batch {
+		var modTime sql.NullInt64 // Unknown for an unmatched canonical path of the baseline
+		if !r.ModTime.IsZero() {
+			modTime = sql.NullInt64{Int64: r.ModTime.UnixNano(), Valid: true}
+		}
+
+		_, err := tx.ExecContext(ctx,
+			`INSERT OR REPLACE INTO files (group_key, path, size, mod_time) VALUES (?, ?, ?, ?)`,
+			r.Key, r.Path, r.Size, modTime,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
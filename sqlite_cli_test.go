@@ -0,0 +1,85 @@
+//go:build sqlite3
+
+package filecollate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Replays the statements of WriteResultsSQLite against a real SQLite through the sqlite3 CLI, since
+// no SQLite driver is a dependency. Run with `go test -tags sqlite3` and sqlite3 on the PATH.
+func TestWriteResultsSQLiteReal(t *testing.T) {
+	cli, err := exec.LookPath("sqlite3")
+	if err != nil {
+		t.Skip("No sqlite3 CLI on the PATH")
+	}
+
+	root := t.TempDir()
+	writeFiles(t, root,
+		[2]string{"a.txt", "dupe"},
+		[2]string{"b.txt", "dupe"},
+		[2]string{"c.txt", "dupe"},
+		[2]string{"it's.txt", "other"},
+		[2]string{"e.txt", "other"},
+	)
+
+	d := newRecordingDriver()
+	db := sql.OpenDB(d)
+	defer db.Close()
+
+	c := Cfg{Paths: []string{root}, Workers: 4, MarkKeeper: true}
+	if err := WriteResultsSQLite(context.Background(), c, db); err != nil {
+		t.Fatal(err)
+	}
+
+	var script strings.Builder
+	for _, e := range d.execs {
+		script.WriteString(bindLiterals(t, e.query, e.args) + ";\n")
+	}
+	script.WriteString("SELECT g.keeper, count(*) FROM groups g JOIN files f ON f.group_key = g.key GROUP BY g.key;\n")
+
+	cmd := exec.Command(cli, filepath.Join(t.TempDir(), "results.db"))
+	cmd.Stdin = strings.NewReader(script.String())
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("sqlite3 failed: %v\n%s", err, out)
+	}
+
+	rows := strings.Split(strings.TrimSpace(string(out)), "\n")
+	sort.Strings(rows)
+	expected := []string{filepath.Join(root, "a.txt") + "|3", filepath.Join(root, "e.txt") + "|2"}
+	if strings.Join(rows, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected the rows %q, got %q", expected, rows)
+	}
+}
+
+// Returns the provided query with its ? placeholders replaced by the args as SQL literals.
+func bindLiterals(t *testing.T, query string, args []driver.Value) string {
+	t.Helper()
+
+	var b strings.Builder
+	for i, part := range strings.Split(query, "?") {
+		if i > 0 {
+			switch v := args[i-1].(type) {
+			case nil:
+				b.WriteString("NULL")
+			case int64:
+				fmt.Fprint(&b, v)
+			case string:
+				b.WriteString("'" + strings.ReplaceAll(v, "'", "''") + "'")
+			default:
+				t.Fatalf("Unexpected arg %T", v)
+			}
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
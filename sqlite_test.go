@@ -0,0 +1,215 @@
+package filecollate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+// Fake database/sql driver recording the committed rows, since no SQLite driver is a dependency.
+type recordingDriver struct {
+	mu      sync.Mutex
+	groups  map[string]int64    // key -> size
+	keepers map[string]string   // key -> keeper, if set
+	files   map[string][]string // key -> paths
+	commits int
+	execs   []recordedExec // Every executed statement in order
+}
+
+type recordedExec struct {
+	query string
+	args  []driver.Value
+}
+
+type recordingConn struct {
+	d       *recordingDriver
+	pending []func() // Inserts of the open transaction, applied on commit
+}
+
+type recordingStmt struct {
+	c     *recordingConn
+	query string
+}
+
+func newRecordingDriver() *recordingDriver {
+	return &recordingDriver{
+		groups:  make(map[string]int64),
+		keepers: make(map[string]string),
+		files:   make(map[string][]string),
+	}
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) { return &recordingConn{d: d}, nil }
+
+// Connector of the driver, which opens it without registering it globally.
+func (d *recordingDriver) Connect(context.Context) (driver.Conn, error) { return d.Open("") }
+func (d *recordingDriver) Driver() driver.Driver                        { return d }
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{c, query}, nil
+}
+func (c *recordingConn) Close() error              { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error) { return c, nil }
+
+func (c *recordingConn) Commit() error {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	for _, insert := range c.pending {
+		insert()
+	}
+	c.pending = nil
+	c.d.commits++
+	return nil
+}
+
+func (c *recordingConn) Rollback() error {
+	c.pending = nil
+	return nil
+}
+
+func (s *recordingStmt) Close() error  { return nil }
+func (s *recordingStmt) NumInput() int { return -1 }
+
+func (s *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	d := s.c.d
+	d.mu.Lock()
+	d.execs = append(d.execs, recordedExec{s.query, args})
+	d.mu.Unlock()
+
+	switch {
+	case strings.Contains(s.query, "CREATE TABLE"):
+	case strings.Contains(s.query, "INTO groups"):
+		key, size := args[0].(string), args[1].(int64)
+		keeper, ok := args[2].(string)
+		s.c.pending = append(s.c.pending, func() {
+			d.groups[key] = size
+			if ok {
+				d.keepers[key] = keeper
+			}
+		})
+	case strings.Contains(s.query, "INTO files"):
+		key, path := args[0].(string), args[1].(string)
+		s.c.pending = append(s.c.pending, func() { d.files[key] = append(d.files[key], path) })
+	default:
+		return nil, errors.New("unexpected query: " + s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *recordingStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestWriteResultsSQLite(t *testing.T) {
+	root := t.TempDir()
+	paths := writeFiles(t, root,
+		[2]string{"a.txt", "dupe"},
+		[2]string{"b.txt", "dupe"},
+		[2]string{"c.txt", "dupe"},
+		[2]string{"d.txt", "other"},
+		[2]string{"e.txt", "other"},
+		[2]string{"f.txt", "unique"},
+	)
+
+	d := newRecordingDriver()
+	db := sql.OpenDB(d)
+	defer db.Close()
+
+	c := Cfg{Paths: []string{root}, KeyGenerator: FullSha256HashKeyGenerator, MarkKeeper: true}
+	if err := WriteResultsSQLite(context.Background(), c, db); err != nil {
+		t.Fatal(err)
+	}
+
+	dupe, _ := HashBytes([]byte("dupe"), c)
+	other, _ := HashBytes([]byte("other"), c)
+	if len(d.groups) != 2 || d.groups[dupe] != 4 || d.groups[other] != 5 {
+		t.Errorf("Expected the dupe and other groups, got %v", d.groups)
+	}
+
+	for key, expected := range map[string][]string{dupe: paths[:3], other: paths[3:5]} {
+		got := d.files[key]
+		slices.Sort(got)
+		if !slices.Equal(got, expected) {
+			t.Errorf("Expected files %v of group %s, got %v", expected, key, got)
+		}
+	}
+
+	if d.keepers[dupe] != paths[0] || d.keepers[other] != paths[3] {
+		t.Errorf("Expected the lexically smallest paths as keepers, got %v", d.keepers)
+	}
+
+	// The first two members of each group are committed together, each further one on its own.
+	if d.commits != 3 {
+		t.Errorf("Expected 3 commits, got %d", d.commits)
+	}
+
+	// The upsert of the groups needs SQLite 3.24 or newer.
+	expected := []string{
+		"CREATE TABLE IF NOT EXISTS groups ( key TEXT PRIMARY KEY, size INTEGER NOT NULL, keeper TEXT ); " +
+			"CREATE TABLE IF NOT EXISTS files ( group_key TEXT NOT NULL REFERENCES groups (key), path TEXT NOT NULL, " +
+			"size INTEGER NOT NULL, mod_time INTEGER, PRIMARY KEY (group_key, path) );",
+		"INSERT INTO groups (key, size, keeper) VALUES (?, ?, ?) ON CONFLICT (key) DO UPDATE SET keeper = coalesce(excluded.keeper, keeper)",
+		"INSERT OR REPLACE INTO files (group_key, path, size, mod_time) VALUES (?, ?, ?, ?)",
+	}
+	var queries []string
+	for _, exec := range d.execs {
+		if query := strings.Join(strings.Fields(exec.query), " "); !slices.Contains(queries, query) {
+			queries = append(queries, query)
+		}
+	}
+	if !slices.Equal(queries, expected) {
+		t.Errorf("Expected the statements %q, got %q", expected, queries)
+	}
+
+	// Nothing is written once the ctx is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := WriteResultsSQLite(ctx, c, db); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the search to be cancelled, got %v", err)
+	}
+	if d.commits != 3 {
+		t.Errorf("Expected no further commits, got %d", d.commits)
+	}
+}
+
+func TestWriteResultsSQLiteExcludeKeeper(t *testing.T) {
+	root := t.TempDir()
+	paths := writeFiles(t, root,
+		[2]string{"a.txt", "dupe"},
+		[2]string{"b.txt", "dupe"},
+		[2]string{"c.txt", "dupe"},
+		[2]string{"d.txt", "other"},
+		[2]string{"e.txt", "other"},
+	)
+
+	d := newRecordingDriver()
+	db := sql.OpenDB(d)
+	defer db.Close()
+
+	c := Cfg{Paths: []string{root}, Workers: 4, KeyGenerator: FullSha256HashKeyGenerator, ExcludeKeeper: true}
+	if err := WriteResultsSQLite(context.Background(), c, db); err != nil {
+		t.Fatal(err)
+	}
+
+	dupe, _ := HashBytes([]byte("dupe"), c)
+	other, _ := HashBytes([]byte("other"), c)
+	for key, expected := range map[string][]string{dupe: paths[1:3], other: paths[4:5]} {
+		got := d.files[key]
+		slices.Sort(got)
+		if !slices.Equal(got, expected) {
+			t.Errorf("Expected files %v without the keeper of group %s, got %v", expected, key, got)
+		}
+	}
+
+	// The excluded keeper can't be marked.
+	c.MarkKeeper = true
+	if err := WriteResultsSQLite(context.Background(), c, db); !errors.Is(err, ErrKeeperExcluded) {
+		t.Errorf("Expected ErrKeeperExcluded, got %v", err)
+	}
+}
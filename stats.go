@@ -0,0 +1,93 @@
+package filecollate
+
+import (
+	"time"
+)
+
+// Phase of a running search.
+type Phase int32
+
+const (
+	PhaseWalking  Phase = iota // Walking the paths to discover files, which are hashed meanwhile.
+	PhaseHashing               // Walks are done, hashing the remaining discovered files.
+	PhaseGrouping              // Hashing is done, grouping the produced keys into the results.
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseWalking:
+		return "walking"
+	case PhaseHashing:
+		return "hashing"
+	case PhaseGrouping:
+		return "grouping"
+	default:
+		return "unknown"
+	}
+}
+
+// Snapshot of the progress of a running search.
+type Stats struct {
+	Phase       Phase         // Current phase of the search.
+	FilesFound  int64         // Files that passed the filters and were queued for hashing.
+	FilesHashed int64         // Files for which a key was generated.
+	DirsSkipped int64         // Directories skipped by the filters.
+	Elapsed     time.Duration // Time since the search started.
+}
+
+// Aggregate summary of a completed search.
+type Summary struct {
+	FilesScanned int64 // Files for which a key was generated.
+	DirsSkipped  int64 // Directories skipped by the filters.
+	Groups       int   // Num of groups found.
+	Duplicates   int   // Num of paths in groups beyond one per group.
+	WastedBytes  int64 // Bytes taken up by all but one copy per group, like FileGroup.WastedBytes.
+	Truncated    bool  // Whether the groups were truncated once they reached Cfg.MaxResultPaths.
+}
+
+// Returns a snapshot of the current progress.
+func (fc *filecollate) stats() Stats {
+	return Stats{
+		Phase:       Phase(fc.phase.Load()),
+		FilesFound:  fc.found.Load(),
+		FilesHashed: fc.hashed.Load(),
+		DirsSkipped: fc.dirsSkipped.Load(),
+		Elapsed:     time.Since(fc.start),
+	}
+}
+
+// Transitions the search to the provided phase and notifies the phase callback, if any.
+func (fc *filecollate) enterPhase(phase Phase) {
+	fc.phase.Store(int32(phase))
+	if fc.onPhase != nil {
+		fc.onPhase(phase, fc.stats())
+	}
+}
+
+// Sends a Stats snapshot to the provided channel on every interval until done is closed, after
+// which a final snapshot is sent and the channel is closed.
+//
+// Interval snapshots are dropped if the receiver isn't ready, and the final one once the receiver
+// wasn't ready for another interval, so a slow (or absent) receiver never stalls the search.
+func (fc *filecollate) reportProgress(progress chan<- Stats, interval time.Duration, done <-chan struct{}) {
+	defer close(progress)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			select {
+			case progress <- fc.stats():
+			default:
+			}
+		case <-done:
+			select {
+			case progress <- fc.stats():
+			case <-time.After(interval):
+			}
+			return
+		}
+	}
+}
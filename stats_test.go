@@ -0,0 +1,79 @@
+package filecollate
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProgressChan(t *testing.T) {
+	root := createSmallFilesTree(t, 2, 5)
+	progress := make(chan Stats, 16)
+
+	lastChan := make(chan Stats)
+	go func() {
+		var last Stats
+		for s := range progress { // Must be closed once the search is done
+			last = s
+		}
+		lastChan <- last
+	}()
+
+	cfg := Cfg{Paths: []string{root}, Workers: 4, ProgressChan: progress, ProgressInterval: time.Millisecond}
+	if _, err := GetResults(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if last := <-lastChan; last.FilesFound != 10 || last.FilesHashed != 10 {
+		t.Errorf("Expected final snapshot with 10 found and hashed files, got %+v", last)
+	}
+}
+
+func TestProgressChanWithoutReader(t *testing.T) {
+	root := createSmallFilesTree(t, 2, 5)
+	progress := make(chan Stats) // Unbuffered and only read once the search returned
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := GetResults(Cfg{Paths: []string{root}, ProgressChan: progress, ProgressInterval: time.Millisecond})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the search to return without a receiver of the progress")
+	}
+
+	for range progress { // Must still be closed
+	}
+}
+
+func TestOnPhase(t *testing.T) {
+	root := createSmallFilesTree(t, 2, 5)
+
+	var phases []Phase
+	var atHashing Stats
+	onPhase := func(phase Phase, stats Stats) {
+		phases = append(phases, phase)
+		if phase == PhaseHashing {
+			atHashing = stats
+		}
+	}
+
+	if _, err := GetResults(Cfg{Paths: []string{root}, Workers: 4, OnPhase: onPhase}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Phase{PhaseWalking, PhaseHashing, PhaseGrouping}
+	if !reflect.DeepEqual(phases, expected) {
+		t.Errorf("Expected phases %v, got %v", expected, phases)
+	}
+
+	if atHashing.Phase != PhaseHashing || atHashing.FilesFound != 10 {
+		t.Errorf("Expected all 10 files to be found once hashing, got %+v", atHashing)
+	}
+}
@@ -0,0 +1,27 @@
+package filecollate
+
+import "context"
+
+// FindUnique runs the search and returns the identities and keys of the files without any
+// duplicate, which can be passed as the KnownUnique of a later search to avoid hashing them again.
+// The returned map can be persisted between runs with encoding/gob.
+func FindUnique(ctx context.Context, c Cfg) (map[FileIdentity]string, error) {
+	uniqueChan := make(chan map[FileIdentity]string, 1)
+	err := run(ctx, c, func(fc *filecollate) {
+		defer close(uniqueChan)
+
+		ids := make(map[string][]FileIdentity) // key -> identities of the files with that key
+		for p := range fc.pairs {
+			ids[p.key] = append(ids[p.key], FileIdentity{p.path, p.size, p.modTime.UnixNano()})
+		}
+
+		unique := make(map[FileIdentity]string)
+		for key, group := range ids {
+			if _, ok := fc.baseline[key]; len(group) == 1 && !ok {
+				unique[group[0]] = key
+			}
+		}
+		uniqueChan <- unique
+	})
+	return <-uniqueChan, err
+}
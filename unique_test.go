@@ -0,0 +1,55 @@
+package filecollate
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestKnownUnique(t *testing.T) {
+	root := t.TempDir()
+	paths := writeFiles(t, root, [2]string{"a.txt", "dupe"}, [2]string{"b.txt", "dupe"}, [2]string{"c.txt", "unique"})
+
+	unique, err := FindUnique(context.Background(), Cfg{Paths: []string{root}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(unique) != 1 {
+		t.Fatalf("Expected only %s to be unique, got %v", paths[2], unique)
+	}
+
+	// Known unique files aren't read again, yet new files matching them are still grouped.
+	hashed := 0
+	countingGenerator := func(path string) (string, error) {
+		hashed++
+		return Crc32HashKeyGenerator(path)
+	}
+	writeFiles(t, root, [2]string{"d.txt", "unique"})
+
+	groups, err := GetResultsSlice(Cfg{
+		Paths:         []string{root},
+		KeyGenerator:  countingGenerator,
+		KnownUnique:   unique,
+		deterministic: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hashed != 3 || len(groups) != 2 {
+		t.Errorf("Expected 3 files hashed and 2 groups, got %d and %v", hashed, groups)
+	}
+
+	// A modified file isn't known anymore.
+	if err := os.WriteFile(paths[2], []byte("modified"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hashed = 0
+	if _, err := GetResultsSlice(Cfg{Paths: []string{root}, KeyGenerator: countingGenerator, KnownUnique: unique, deterministic: true}); err != nil {
+		t.Fatal(err)
+	}
+	if hashed != 4 {
+		t.Errorf("Expected all 4 files hashed, got %d", hashed)
+	}
+}
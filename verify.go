@@ -0,0 +1,229 @@
+package filecollate
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Re-hashes the members of a previously found group with the configured KeyGenerator and returns
+// the subset that still exists and still shares a key. Useful to re-check stale results before
+// acting on them, e.g. right before an automated cleanup.
+//
+// If the members no longer agree on a single key, the largest subset sharing a key wins, and nil
+// is returned once fewer than two members are left. With Cfg.RevalidateBytes, the members of the
+// subset are additionally compared byte-for-byte with its first member, concurrently like the
+// members are hashed by VerifyGroups.
+func RevalidateGroup(paths []string, c Cfg) ([]string, error) {
+	c.defaults()
+	generatorFn := c.HashOptions.apply(c.KeyGenerator)
+
+	groups := make(map[string][]string)
+	bestKey := ""
+
+	for _, path := range paths {
+		key, err := generateMemberKey(path, generatorFn)
+		if err != nil {
+			if errors.Is(err, ErrSkipFile) || errors.Is(err, fs.ErrNotExist) {
+				continue // File is gone, so it's no longer part of the group.
+			}
+			return nil, err
+		}
+
+		groups[key] = append(groups[key], path)
+		if len(groups[key]) > len(groups[bestKey]) {
+			bestKey = key
+		}
+	}
+
+	valid := groups[bestKey]
+	if c.RevalidateBytes && len(valid) > 1 {
+		var err error
+		if valid, err = sameContentsAs(valid, c); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(valid) < 2 {
+		return nil, nil
+	}
+
+	return valid, nil
+}
+
+// Returns the provided paths whose contents are identical to those of the first one, which are
+// compared concurrently by the configured num of workers, while keeping both files of each
+// comparison within MaxOpenFiles. Paths that no longer exist are left out.
+func sameContentsAs(paths []string, c Cfg) ([]string, error) {
+	g := new(errgroup.Group)
+	g.SetLimit(concurrencyLimit(c, 2))
+
+	equal := make([]bool, len(paths))
+	for i, path := range paths[1:] {
+		g.Go(func() error {
+			same, err := sameContents(paths[0], path)
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			equal[i+1] = same
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	same := paths[:1]
+	for i, path := range paths[1:] {
+		if equal[i+1] {
+			same = append(same, path)
+		}
+	}
+	return same, nil
+}
+
+// Returns the num of tasks run at once by the configured num of workers, so that the provided num
+// of files each task keeps open stays within MaxOpenFiles. At least one task is always run.
+func concurrencyLimit(c Cfg, filesPerTask int) int {
+	if c.MaxOpenFiles <= 0 {
+		return c.Workers
+	}
+	return max(1, min(c.Workers, c.MaxOpenFiles/filesPerTask))
+}
+
+// Size of the chunks compared by sameContents.
+const compareChunkSize = 64 * 1024
+
+// Compares the contents of the provided files byte-for-byte.
+func sameContents(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	bufA, bufB := make([]byte, compareChunkSize), make([]byte, compareChunkSize)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+
+		endA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		endB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		switch {
+		case errA != nil && !endA:
+			return false, errA
+		case errB != nil && !endB:
+			return false, errB
+		case endA || endB:
+			return endA && endB, nil
+		}
+	}
+}
+
+// Result of verifying a single group with VerifyGroups.
+type GroupVerification struct {
+	Paths   []string          // Members of the verified group.
+	Passed  bool              // Whether all members still exist and share the same key.
+	Keys    map[string]string // Key of each member that could be hashed, by path.
+	Missing []string          // Members that no longer exist.
+	Errors  map[string]error  // Members that couldn't be hashed for other reasons, by path.
+}
+
+// Re-reads every member of every provided group with the configured KeyGenerator and reports which
+// groups still hash identically, as a last safety check before acting destructively on cached
+// results. The members are hashed concurrently by the configured num of workers (at most
+// MaxOpenFiles at once), regardless of their group, so that a few large groups are verified as
+// fast as many small ones. The returned verifications are in the same order as the groups.
+//
+// Failing members are reported in the verification rather than as an error, a group only passes
+// if all of its members still exist and share the same key.
+func VerifyGroups(groups [][]string, c Cfg) ([]GroupVerification, error) {
+	c.defaults()
+	generatorFn := c.HashOptions.apply(c.KeyGenerator)
+
+	g := new(errgroup.Group)
+	g.SetLimit(concurrencyLimit(c, 1))
+
+	keys := make([][]memberKey, len(groups))
+	for i, paths := range groups {
+		keys[i] = make([]memberKey, len(paths))
+		for j, path := range paths {
+			g.Go(func() error {
+				key, err := generateMemberKey(path, generatorFn)
+				keys[i][j] = memberKey{key, err}
+				return nil
+			})
+		}
+	}
+	err := g.Wait()
+
+	verifications := make([]GroupVerification, len(groups))
+	for i, paths := range groups {
+		verifications[i] = verifyGroup(paths, keys[i])
+	}
+
+	return verifications, err
+}
+
+// Key of a group member or the error which prevented generating it.
+type memberKey struct {
+	key string
+	err error
+}
+
+// Returns the verification of the provided group from the keys of its members, in the same order.
+func verifyGroup(paths []string, keys []memberKey) GroupVerification {
+	v := GroupVerification{
+		Paths:  paths,
+		Keys:   make(map[string]string),
+		Errors: make(map[string]error),
+	}
+
+	for i, path := range paths {
+		key, err := keys[i].key, keys[i].err
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			v.Missing = append(v.Missing, path)
+		case err != nil:
+			v.Errors[path] = err
+		default:
+			v.Keys[path] = key
+		}
+	}
+
+	v.Passed = len(paths) > 1 && len(v.Keys) == len(paths)
+	for _, key := range v.Keys {
+		if key != v.Keys[paths[0]] {
+			v.Passed = false
+		}
+	}
+
+	return v
+}
+
+// Generates the key of a group member, which must still be a regular file.
+func generateMemberKey(path string, generatorFn KeyGeneratorFunc) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	if !fi.Mode().IsRegular() {
+		return "", ErrSkipFile
+	}
+
+	return generatorFn(path)
+}
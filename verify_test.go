@@ -0,0 +1,228 @@
+package filecollate
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Helper to write the given name -> content files into dir and return their paths in order.
+func writeFiles(t *testing.T, dir string, files ...[2]string) []string {
+	t.Helper()
+
+	var paths []string
+	for _, f := range files {
+		path := filepath.Join(dir, f[0])
+		if err := os.WriteFile(path, []byte(f[1]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	return paths
+}
+
+func TestRevalidateGroup(t *testing.T) {
+	paths := writeFiles(t, t.TempDir(),
+		[2]string{"a.txt", "same"},
+		[2]string{"b.txt", "same"},
+		[2]string{"c.txt", "same"},
+		[2]string{"d.txt", "same"},
+	)
+
+	os.Remove(paths[1])                           // Vanished since the scan
+	os.WriteFile(paths[3], []byte("edit"), 0o644) // Content changed since the scan
+
+	valid, err := RevalidateGroup(paths, Cfg{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{paths[0], paths[2]}
+	if !reflect.DeepEqual(valid, expected) {
+		t.Errorf("Expected %v, got %v", expected, valid)
+	}
+
+	os.Remove(paths[2])
+
+	valid, err = RevalidateGroup(paths, Cfg{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if valid != nil {
+		t.Errorf("Expected nil once a single member is left, got %v", valid)
+	}
+}
+
+func TestRevalidateBytes(t *testing.T) {
+	root := t.TempDir()
+	prefix := strings.Repeat("x", 16*1024) // Crc32HashKeyGenerator only hashes the first 16KB
+	paths := writeFiles(t, root,
+		[2]string{"a.txt", prefix + "tail"},
+		[2]string{"b.txt", prefix + "tail"},
+		[2]string{"c.txt", prefix + "other"},
+	)
+
+	valid, err := RevalidateGroup(paths, Cfg{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(valid) != 3 {
+		t.Fatalf("Expected the partial hash to match all members, got %v", valid)
+	}
+
+	valid, err = RevalidateGroup(paths, Cfg{RevalidateBytes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(valid, paths[:2]) {
+		t.Errorf("Expected %v, got %v", paths[:2], valid)
+	}
+}
+
+func TestVerifyGroups(t *testing.T) {
+	paths := writeFiles(t, t.TempDir(),
+		[2]string{"a.txt", "same"},
+		[2]string{"b.txt", "same"},
+		[2]string{"c.txt", "same"},
+		[2]string{"d.txt", "same"},
+		[2]string{"e.txt", "same"},
+	)
+
+	os.WriteFile(paths[3], []byte("edit"), 0o644)
+	os.Remove(paths[4])
+
+	groups := [][]string{paths[:2], {paths[2], paths[3]}, {paths[0], paths[4]}}
+
+	verifications, err := VerifyGroups(groups, Cfg{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(verifications) != 3 {
+		t.Fatalf("Expected 3 verifications, got %d", len(verifications))
+	}
+
+	if !verifications[0].Passed {
+		t.Errorf("Expected untouched group to pass, got %+v", verifications[0])
+	}
+
+	if v := verifications[1]; v.Passed || v.Keys[paths[2]] == v.Keys[paths[3]] {
+		t.Errorf("Expected group with edited member to fail with differing keys, got %+v", v)
+	}
+
+	if v := verifications[2]; v.Passed || !reflect.DeepEqual(v.Missing, paths[4:]) {
+		t.Errorf("Expected group with deleted member to fail with %v missing, got %+v", paths[4:], v)
+	}
+}
+
+func TestMaxOpenFiles(t *testing.T) {
+	root := createSmallFilesTree(t, 4, 10)
+
+	var running, peak atomic.Int32
+	generator := func(path string) (string, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return Crc32HashKeyGenerator(path)
+	}
+
+	cfg := Cfg{Paths: []string{root}, Workers: 8, KeyGenerator: generator, MaxOpenFiles: 2}
+	groups, err := GetResultsSlice(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := peak.Load(); p > 2 {
+		t.Errorf("Expected at most 2 files to be hashed at once by the search, got %d", p)
+	}
+
+	peak.Store(0)
+	if _, err := VerifyGroups(groups, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if p := peak.Load(); p > 2 {
+		t.Errorf("Expected at most 2 files to be hashed at once by VerifyGroups, got %d", p)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	tests := []struct {
+		workers, maxOpen, perTask, limit int
+	}{
+		{8, 0, 2, 8},  // Unlimited open files
+		{8, 6, 1, 6},  // One file per task
+		{8, 6, 2, 3},  // Both files of a comparison count
+		{8, 20, 2, 8}, // Within the limit
+		{8, 1, 2, 1},  // Always at least one task
+	}
+
+	for _, tt := range tests {
+		if limit := concurrencyLimit(Cfg{Workers: tt.workers, MaxOpenFiles: tt.maxOpen}, tt.perTask); limit != tt.limit {
+			t.Errorf("%+v: expected a limit of %d, got %d", tt, tt.limit, limit)
+		}
+	}
+}
+
+// Writes the provided num of groups of 1MB members to a temp dir.
+func writeLargeGroups(b *testing.B, n, members int) [][]string {
+	b.Helper()
+	dir := b.TempDir()
+	contents := bytes.Repeat([]byte("large"), 200*1024)
+
+	var groups [][]string
+	for i := 0; i < n; i++ {
+		var group []string
+		for j := 0; j < members; j++ {
+			path := filepath.Join(dir, fmt.Sprintf("%d-%d", i, j))
+			if err := os.WriteFile(path, append(contents, byte(i)), 0o644); err != nil {
+				b.Fatal(err)
+			}
+			group = append(group, path)
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+func BenchmarkVerifyGroups(b *testing.B) {
+	// Few large groups, where verifying only across groups would leave most workers idle.
+	groups := writeLargeGroups(b, 4, 16)
+
+	cfg := Cfg{KeyGenerator: FullSha256HashKeyGenerator, Workers: 8}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := VerifyGroups(groups, cfg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRevalidateBytes(b *testing.B) {
+	// A single large group, whose members are compared with the first one concurrently.
+	group := writeLargeGroups(b, 1, 32)[0]
+
+	cfg := Cfg{KeyGenerator: Crc32HashKeyGenerator, Workers: 8, MaxOpenFiles: 8, RevalidateBytes: true}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		valid, err := RevalidateGroup(group, cfg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(valid) != len(group) {
+			b.Fatalf("Expected all %d members to be identical, got %d", len(group), len(valid))
+		}
+	}
+}
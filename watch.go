@@ -0,0 +1,327 @@
+package filecollate
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Duplicate reported by Watch whenever a group gains a member.
+type DuplicateEvent struct {
+	Key   string   // key of the group
+	Path  string   // file that joined the group, empty for groups found by the initial scan
+	Paths []string // all current members of the group, sorted
+}
+
+// Watch does an initial scan of the provided Cfg, sends its groups to the events channel, and then
+// keeps watching the paths for changes, hashing created and modified files to send an event as soon
+// as they join a group. Files are only hashed once they didn't change for 250ms, so a file still
+// being written is hashed once complete. Deleted files and dirs are pruned from the groups. The
+// events channel is closed once Watch returns, which happens when the provided context is cancelled
+// (returning the context's error) or the watcher fails.
+//
+// The path -> key index of every scanned file is kept in memory for the whole lifetime of Watch, so
+// memory grows with the size of the watched trees. On Linux, every watched dir takes an inotify watch,
+// which is limited per user by fs.inotify.max_user_watches; exceeding it during the initial scan makes
+// Watch fail, later on it's reported to OnError and the dir is left unwatched. ExcludeKeeper and the
+// BaselineDB don't apply to the events, which always contain the full membership of a group.
+func Watch(ctx context.Context, c Cfg, events chan<- DuplicateEvent) error {
+	defer close(events)
+	c.defaults()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// Watching before the initial scan, so that no changes in between are missed.
+	w := &watch{
+		fc:      newFilecollate(ctx, c),
+		watcher: watcher,
+		index:   newWatchIndex(),
+		events:  events,
+		pending: make(map[string]time.Time),
+	}
+	for _, root := range c.Paths {
+		if err := w.watchTree(root, false); err != nil {
+			return err
+		}
+	}
+
+	scanned := make(chan struct{})
+	err = run(ctx, c, func(fc *filecollate) {
+		defer close(scanned)
+		for p := range fc.pairs {
+			w.index.add(p.path, p.key)
+		}
+	})
+	<-scanned
+	if err != nil {
+		return err
+	}
+
+	if err := w.sendInitialGroups(); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if err := w.handle(ev); err != nil {
+				return err
+			}
+		case <-w.flush:
+			if err := w.hashPending(); err != nil {
+				return err
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			w.fc.reportError("", err) // e.g. fsnotify.ErrEventOverflow, events were lost
+		}
+	}
+}
+
+type watch struct {
+	fc      *filecollate // filters and generates the keys of changed files
+	watcher *fsnotify.Watcher
+	index   *watchIndex
+	events  chan<- DuplicateEvent
+
+	// Files created or written, by the time of their last change. They're only hashed once they
+	// didn't change for writeDebounce, so that a file still being written isn't hashed repeatedly
+	// with flickering keys.
+	pending map[string]time.Time
+	flush   <-chan time.Time // fires once the next pending file may be quiet, nil if none
+}
+
+// Time a file must not change before it's hashed by Watch.
+const writeDebounce = 250 * time.Millisecond
+
+// Defers hashing the provided file until it didn't change for writeDebounce.
+func (w *watch) schedule(path string) {
+	w.pending[path] = time.Now()
+	if w.flush == nil {
+		w.flush = time.After(writeDebounce)
+	}
+}
+
+// Hashes the pending files which didn't change for writeDebounce, in the order of their paths.
+func (w *watch) hashPending() error {
+	w.flush = nil
+
+	var quiet []string
+	var next time.Duration
+	for path, changed := range w.pending {
+		if wait := writeDebounce - time.Since(changed); wait > 0 {
+			if next == 0 || wait < next {
+				next = wait
+			}
+			continue
+		}
+		quiet = append(quiet, path)
+	}
+	if next > 0 {
+		w.flush = time.After(next)
+	}
+
+	slices.Sort(quiet)
+	for _, path := range quiet {
+		delete(w.pending, path)
+
+		fi, err := os.Lstat(path)
+		if err != nil {
+			continue // Already gone again
+		}
+		if err := w.handleFile(path, fi); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sends the groups found by the initial scan in the order of their keys.
+func (w *watch) sendInitialGroups() error {
+	keys := maps.Keys(w.index.groups)
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		if paths := w.index.groups[key]; len(paths) > 1 {
+			if err := w.send(DuplicateEvent{Key: key, Paths: slices.Clone(paths)}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w *watch) handle(ev fsnotify.Event) error {
+	switch {
+	case ev.Has(fsnotify.Remove), ev.Has(fsnotify.Rename):
+		// The new name of a renamed file or dir arrives as a separate create event.
+		delete(w.pending, ev.Name)
+		w.index.remove(ev.Name)
+		w.index.removeDir(ev.Name)
+	case ev.Has(fsnotify.Create):
+		fi, err := os.Lstat(ev.Name)
+		if err != nil {
+			return nil // Already gone again
+		}
+		if fi.IsDir() {
+			if reason, _ := w.fc.skipDirReason(ev.Name); reason != 0 {
+				return nil
+			}
+			// Files may have been created (or moved in) before the dir was watched.
+			if err := w.watchTree(ev.Name, true); err != nil {
+				w.fc.reportError(ev.Name, err)
+			}
+			return nil
+		}
+		w.schedule(ev.Name)
+	case ev.Has(fsnotify.Write):
+		w.schedule(ev.Name)
+	}
+
+	return nil
+}
+
+// Hashes the provided file and sends an event if it joined a group.
+func (w *watch) handleFile(path string, fi os.FileInfo) error {
+	if !fi.Mode().IsRegular() || fi.Size() == 0 || w.fc.filters.skipFile(path) {
+		w.index.remove(path)
+		return nil
+	}
+
+	key, err := w.fc.fileKey(path, fi)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			w.fc.reportError(path, err) // A single unreadable file must not stop the watch.
+		}
+		w.index.remove(path)
+		return nil
+	}
+	if key == "" {
+		w.index.remove(path)
+		return nil
+	}
+
+	paths, joined := w.index.add(path, key)
+	if !joined || len(paths) < 2 {
+		return nil
+	}
+
+	return w.send(DuplicateEvent{Key: key, Path: path, Paths: slices.Clone(paths)})
+}
+
+func (w *watch) send(ev DuplicateEvent) error {
+	select {
+	case w.events <- ev:
+		return nil
+	case <-w.fc.ctx.Done():
+		return context.Cause(w.fc.ctx)
+	}
+}
+
+// Watches the provided dir and all of its subdirs not skipped by the filters, hashing the files
+// found along the way if hash is set.
+func (w *watch) watchTree(root string, hash bool) error {
+	return filepath.WalkDir(root, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil // Unreadable subdir, best effort
+		}
+
+		if de.IsDir() {
+			if path != root {
+				if reason, _ := w.fc.skipDirReason(path); reason != 0 {
+					return filepath.SkipDir
+				}
+			}
+			return w.watcher.Add(path)
+		}
+
+		if hash && de.Type().IsRegular() {
+			fi, err := de.Info()
+			if err != nil {
+				return nil
+			}
+			return w.handleFile(path, fi)
+		}
+
+		return nil
+	})
+}
+
+// In-memory index of the watched files and their groups.
+type watchIndex struct {
+	keys   map[string]string   // path -> key
+	groups map[string][]string // key -> sorted paths
+}
+
+func newWatchIndex() *watchIndex {
+	return &watchIndex{keys: make(map[string]string), groups: make(map[string][]string)}
+}
+
+// Adds the provided path to the group of the key, moving it from its previous group if the key
+// changed. Returns the group and whether the path joined it.
+func (i *watchIndex) add(path, key string) ([]string, bool) {
+	if old, ok := i.keys[path]; ok {
+		if old == key {
+			return i.groups[key], false
+		}
+		i.remove(path)
+	}
+
+	i.keys[path] = key
+	paths := i.groups[key]
+	pos, _ := slices.BinarySearch(paths, path)
+	i.groups[key] = slices.Insert(paths, pos, path)
+
+	return i.groups[key], true
+}
+
+func (i *watchIndex) remove(path string) {
+	key, ok := i.keys[path]
+	if !ok {
+		return
+	}
+	delete(i.keys, path)
+
+	paths := i.groups[key]
+	if pos, found := slices.BinarySearch(paths, path); found {
+		paths = slices.Delete(paths, pos, pos+1)
+	}
+	if len(paths) == 0 {
+		delete(i.groups, key)
+		return
+	}
+	i.groups[key] = paths
+}
+
+// Removes all paths below the provided dir.
+func (i *watchIndex) removeDir(dir string) {
+	prefix := dir + string(filepath.Separator)
+	for path := range i.keys {
+		if strings.HasPrefix(path, prefix) {
+			i.remove(path)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package filecollate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	paths := writeFiles(t, dir, [2]string{"a.txt", "same"}, [2]string{"b.txt", "same"}, [2]string{"c.txt", "unique"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan DuplicateEvent)
+	errChan := make(chan error, 1)
+	go func() { errChan <- Watch(ctx, Cfg{Paths: []string{dir}}, events) }()
+
+	next := func() DuplicateEvent {
+		t.Helper()
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for a duplicate event")
+			return DuplicateEvent{}
+		}
+	}
+
+	if ev := next(); ev.Path != "" || !reflect.DeepEqual(ev.Paths, paths[:2]) {
+		t.Fatalf("Expected the initial group of %v, got %+v", paths[:2], ev)
+	}
+
+	// A new copy joins the group.
+	d := writeFiles(t, dir, [2]string{"d.txt", "same"})[0]
+	if ev := next(); ev.Path != d || len(ev.Paths) != 3 {
+		t.Fatalf("Expected %s to join the group, got %+v", d, ev)
+	}
+
+	// Deleted files are pruned, files in new dirs are picked up.
+	if err := os.Remove(paths[0]); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	e := writeFiles(t, sub, [2]string{"e.txt", "unique"})[0]
+
+	expected := []string{paths[2], e}
+	if ev := next(); ev.Path != e || !reflect.DeepEqual(ev.Paths, expected) {
+		t.Fatalf("Expected %v, got %+v", expected, ev)
+	}
+
+	e2 := writeFiles(t, sub, [2]string{"f.txt", "same"})[0]
+	expected = []string{paths[1], d, e2}
+	if ev := next(); !reflect.DeepEqual(ev.Paths, expected) {
+		t.Fatalf("Expected the deleted file to be pruned from %v, got %+v", expected, ev)
+	}
+
+	cancel()
+	if err := <-errChan; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestWatchDebouncesWrites(t *testing.T) {
+	dir := t.TempDir()
+	paths := writeFiles(t, dir, [2]string{"a.txt", "same"}, [2]string{"b.txt", "other"})
+
+	var hashed atomic.Int32
+	generator := func(path string) (string, error) {
+		if filepath.Base(path) == "growing.txt" {
+			hashed.Add(1)
+		}
+		return FullSha256HashKeyGenerator(path)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan DuplicateEvent)
+	go Watch(ctx, Cfg{Paths: []string{dir}, KeyGenerator: generator}, events)
+
+	// Written in chunks quicker than the debounce, so it's only hashed once complete.
+	time.Sleep(100 * time.Millisecond) // Initial scan without any group
+	growing := filepath.Join(dir, "growing.txt")
+	f, err := os.Create(growing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range []string{"s", "a", "m", "e"} {
+		f.WriteString(chunk)
+		time.Sleep(writeDebounce / 5)
+	}
+	f.Close()
+
+	select {
+	case ev := <-events:
+		if ev.Path != growing || !reflect.DeepEqual(ev.Paths, []string{paths[0], growing}) {
+			t.Errorf("Expected %s to join the group of %s, got %+v", growing, paths[0], ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a duplicate event")
+	}
+
+	if n := hashed.Load(); n != 1 {
+		t.Errorf("Expected the file to be hashed once, got %d", n)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package filecollate
+
+import (
+	"errors"
+)
+
+// Extended attributes aren't supported on this platform, so XattrKeyGenerator always falls back.
+func getxattr(path, attr string) (string, error) {
+	return "", errors.ErrUnsupported
+}
@@ -0,0 +1,25 @@
+//go:build linux || darwin
+
+package filecollate
+
+import (
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Reads the value of the named extended attribute of the provided file.
+func getxattr(path, attr string) (string, error) {
+	size, err := unix.Getxattr(path, attr, nil)
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, size)
+	n, err := unix.Getxattr(path, attr, buf)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(buf[:n])), nil
+}
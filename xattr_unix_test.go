@@ -0,0 +1,40 @@
+//go:build linux || darwin
+
+package filecollate
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestXattrKeyGenerator(t *testing.T) {
+	file, clean := createTempFile("Hello, World!")
+	defer clean()
+
+	keygen := XattrKeyGenerator("user.checksum")
+
+	// Without the attribute, the key is the full sha256 of the contents.
+	key, err := keygen(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, _ := FullSha256HashKeyGenerator(file.Name())
+	if key != expected {
+		t.Errorf("Expected fallback key %s, got %s", expected, key)
+	}
+
+	if err := unix.Setxattr(file.Name(), "user.checksum", []byte("stored-checksum\n"), 0); err != nil {
+		t.Skipf("Extended attributes are not supported: %v", err)
+	}
+
+	key, err = keygen(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key != "stored-checksum" {
+		t.Errorf("Expected stored-checksum, got %s", key)
+	}
+}